@@ -0,0 +1,233 @@
+package webfw
+
+import (
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/OpenDriversLog/goodl-lib/translate"
+	"github.com/OpenDriversLog/redistore"
+	"golang.org/x/net/context"
+)
+
+// App is a webfw site owning its config, views, binders, caches & session store.
+// Several Apps can run in one process (e.g. the public site and the admin site).
+// The package-level functions & variables work on the default App (see DefaultApp).
+type App struct {
+	// The fields point to the state of the App - for the default App they point to the package-level variables,
+	// so code assigning e.g. webfw.MyErrorController or webfw.MVCBinders keeps working. Such assignments bypass
+	// the locks of the App though, so only do them before serving requests - use the methods of the App afterwards.
+	configMutex       *sync.RWMutex
+	config            **ServerConfig
+	views             **ViewEngine
+	binders           *map[string]MVCBinder
+	sessionStore      **redistore.RediStore
+	redisInited       *bool
+	redisMutex        *sync.Mutex
+	fileCache         *FileCacheMap
+	errorController   *ErrorController
+	errorPolishFunc   *func(*ViewData, context.Context, *http.Request, string) string
+	defaultTranslater **translate.Translater
+	subscribers       *configSubscriberMap
+	// fsys is set by SetFS - if nil, files are read from disk.
+	fsys fs.FS
+	// viewOptions are set by SetViewOptions.
+	viewOptions ViewOptions
+	// pageStore holds the pages of the PageCaches without own Store.
+	pageStore *MemoryPageStore
+	// routers are the Routers created by NewRouter, see URLFor.
+	routers routerList
+	// precompiled is set by Precompile, so every ViewEngine swapped in is precompiled too - guarded by configMutex.
+	precompiled bool
+	// profile is the Profile of the ServerConfig profileOf, see Profile - guarded by configMutex.
+	profile   *Profile
+	profileOf *ServerConfig
+	// metrics are served by MetricsHandler.
+	metrics *appMetrics
+	// mutex guards binders & defaultTranslater - binders may be registered while serving requests, e.g. by a Router.
+	mutex sync.RWMutex
+}
+
+// FileCacheMap caches the content of files served by ProvideFolderContentHandler by URL path.
+type FileCacheMap struct {
+	sync.RWMutex
+	m map[string][]byte
+}
+
+// configSubscriberMap contains the ConfigChangeFuncs by ServerConfig field name.
+type configSubscriberMap struct {
+	sync.Mutex
+	m map[string][]ConfigChangeFunc
+}
+
+var defaultApp = &App{
+	configMutex:       configMutex,
+	config:            &config,
+	views:             &V,
+	binders:           &MVCBinders,
+	sessionStore:      &SessionStore,
+	redisInited:       &redisInited,
+	redisMutex:        redisMutex,
+	fileCache:         &FileCache,
+	errorController:   &MyErrorController,
+	errorPolishFunc:   &ErrorViewDataPolishFunc,
+	defaultTranslater: &defaultTranslater,
+	subscribers:       &configSubscribers,
+	pageStore:         NewMemoryPageStore(),
+	metrics:           newAppMetrics(),
+}
+
+// DefaultApp returns the App used by the package-level functions.
+func DefaultApp() *App {
+	return defaultApp
+}
+
+// NewApp returns a new App with its own state using the given ServerConfig.
+func NewApp(c *ServerConfig) *App {
+	var (
+		cfg        *ServerConfig
+		views      *ViewEngine
+		binders    = make(map[string]MVCBinder)
+		store      *redistore.RediStore
+		inited     bool
+		ec         ErrorController
+		polish     func(*ViewData, context.Context, *http.Request, string) string
+		translater *translate.Translater
+	)
+	a := &App{
+		configMutex:       &sync.RWMutex{},
+		config:            &cfg,
+		views:             &views,
+		binders:           &binders,
+		sessionStore:      &store,
+		redisInited:       &inited,
+		redisMutex:        &sync.Mutex{},
+		fileCache:         &FileCacheMap{m: make(map[string][]byte)},
+		errorController:   &ec,
+		errorPolishFunc:   &polish,
+		defaultTranslater: &translater,
+		subscribers:       &configSubscriberMap{m: make(map[string][]ConfigChangeFunc)},
+		pageStore:         NewMemoryPageStore(),
+		metrics:           newAppMetrics(),
+	}
+	a.OnConfigChange("RedisAddress", a.resetSessionStore)
+	a.SetConfig(c)
+	return a
+}
+
+// SetConfig sets the ServerConfig of the App.
+func (a *App) SetConfig(c *ServerConfig) {
+	v, _ := a.newViewEngine(c)
+	a.swapConfig(c, v)
+}
+
+// Config gets the ServerConfig of the App.
+func (a *App) Config() *ServerConfig {
+	a.configMutex.RLock()
+	c := *a.config
+	a.configMutex.RUnlock()
+	if c != nil {
+		return c
+	}
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	if *a.config == nil {
+		*a.config = NewServerConfig()
+	}
+	return *a.config
+}
+
+// Views gets the ViewEngine belonging to the current ServerConfig of the App.
+func (a *App) Views() *ViewEngine {
+	a.configMutex.RLock()
+	v := *a.views
+	a.configMutex.RUnlock()
+	if v != nil {
+		return v
+	}
+	c := a.Config()
+	fsys := a.customFS()
+	opts := a.engineViewOptions()
+	a.configMutex.Lock()
+	defer a.configMutex.Unlock()
+	if *a.views == nil {
+		*a.views, _ = newViewEngineFor(c, fsys, opts, a.metrics)
+	}
+	return *a.views
+}
+
+// SetBinder registers the MVCBinder for the given binderKey.
+func (a *App) SetBinder(binderKey string, binder MVCBinder) {
+	a.mutex.Lock()
+	(*a.binders)[binderKey] = binder
+	a.mutex.Unlock()
+}
+
+// Binder gets the MVCBinder for the given binderKey.
+func (a *App) Binder(binderKey string) (binder MVCBinder, ok bool) {
+	a.mutex.RLock()
+	binder, ok = (*a.binders)[binderKey]
+	a.mutex.RUnlock()
+	return
+}
+
+// Binders returns a copy of all registered MVCBinders by binderKey.
+func (a *App) Binders() map[string]MVCBinder {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	binders := make(map[string]MVCBinder, len(*a.binders))
+	for k, b := range *a.binders {
+		binders[k] = b
+	}
+	return binders
+}
+
+// SessionStore returns the SessionStore of the App, initialized by the first request (see WrapWithInit).
+func (a *App) SessionStore() *redistore.RediStore {
+	a.redisMutex.Lock()
+	defer a.redisMutex.Unlock()
+	return *a.sessionStore
+}
+
+// FileCache returns the cache of files served by ProvideFolderContentHandler.
+func (a *App) FileCache() *FileCacheMap {
+	return a.fileCache
+}
+
+// SetErrorController sets the ErrorController used to display error pages.
+func (a *App) SetErrorController(ec ErrorController) {
+	*a.errorController = ec
+}
+
+// ErrorController gets the ErrorController used to display error pages.
+func (a *App) ErrorController() ErrorController {
+	return *a.errorController
+}
+
+// SetErrorViewDataPolishFunc sets the function used to polish error pages of Non-MVC-Handlers (see DirectShowError_NoVD).
+func (a *App) SetErrorViewDataPolishFunc(fn func(*ViewData, context.Context, *http.Request, string) string) {
+	*a.errorPolishFunc = fn
+}
+
+// DefaultTranslater returns the default translater of the App (if not set, currently "de-DE")
+func (a *App) DefaultTranslater() *translate.Translater {
+	a.mutex.RLock()
+	t := *a.defaultTranslater
+	a.mutex.RUnlock()
+	if t != nil {
+		return t
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if *a.defaultTranslater == nil {
+		*a.defaultTranslater = GetTranslater("de-DE")
+	}
+	return *a.defaultTranslater
+}
+
+// SetDefaultTranslater sets the default translater of the App.
+func (a *App) SetDefaultTranslater(t *translate.Translater) {
+	a.mutex.Lock()
+	*a.defaultTranslater = t
+	a.mutex.Unlock()
+}
@@ -0,0 +1,249 @@
+package webfw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Compufreak345/alice"
+	"github.com/Compufreak345/dbg"
+	"golang.org/x/net/context"
+)
+
+const aTag = dbg.Tag("webfw/assets.go")
+
+// AssetFingerprintLength is the number of hex digits of the SHA-256 of a file used as its fingerprint.
+var AssetFingerprintLength = 8
+
+// AssetCacheControl is sent with every file served by a fingerprinted name, see ProvideAssetHandler.
+var AssetCacheControl = "public, max-age=31536000, immutable"
+
+// AssetManifest maps the files below the ServerConfig.StaticDirs to names containing a fingerprint of their content,
+// e.g. "static/app.css" to "static/app.3f9a1c0b.css". Names are relative to RootDir.
+// It is built with the ViewEngine, but only if the Profile caches files - otherwise the asset template
+// function falls back to the Version, so changed files show up on the next request.
+type AssetManifest struct {
+	sync.RWMutex
+	fingerprinted map[string]string
+	original      map[string]string
+	fsys          fs.FS
+	dirs          []string
+}
+
+// newAssetManifest returns a new AssetManifest hashing the given directories of fsys.
+func newAssetManifest(fsys fs.FS, dirs []string) *AssetManifest {
+	m := &AssetManifest{fsys: fsys, dirs: dirs}
+	m.Rebuild()
+	return m
+}
+
+// Rebuild hashes all files below the static folders again, e.g. after they were replaced without a restart.
+func (m *AssetManifest) Rebuild() {
+	if m == nil {
+		return
+	}
+	fingerprinted := make(map[string]string)
+	original := make(map[string]string)
+	for _, dir := range m.dirs {
+		err := fs.WalkDir(m.fsys, fsName("", dir), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+			sum, err := hashFile(m.fsys, p)
+			if err != nil {
+				dbg.W(aTag, "Could not hash asset %s : %v", p, err)
+				return nil
+			}
+			name := fingerprintName(p, sum)
+			fingerprinted[p] = name
+			original[name] = p
+			return nil
+		})
+		if err != nil {
+			dbg.E(aTag, "Error building asset manifest for %s : %v", dir, err)
+		}
+	}
+	m.Lock()
+	m.fingerprinted = fingerprinted
+	m.original = original
+	m.Unlock()
+	dbg.I(aTag, "Built asset manifest - %d files", len(fingerprinted))
+}
+
+// Fingerprinted returns the fingerprinted name of the file with the given name (relative to RootDir, e.g. "static/app.css").
+func (m *AssetManifest) Fingerprinted(name string) (fingerprinted string, ok bool) {
+	if m == nil {
+		return "", false
+	}
+	m.RLock()
+	fingerprinted, ok = m.fingerprinted[strings.TrimPrefix(name, "/")]
+	m.RUnlock()
+	return
+}
+
+// Original returns the name of the file a fingerprinted name (e.g. "static/app.3f9a1c0b.css") belongs to.
+// Names of an older version of the file are not resolved.
+func (m *AssetManifest) Original(fingerprinted string) (name string, ok bool) {
+	if m == nil {
+		return "", false
+	}
+	m.RLock()
+	name, ok = m.original[strings.TrimPrefix(fingerprinted, "/")]
+	m.RUnlock()
+	return
+}
+
+// Names returns the names of all files in the AssetManifest, sorted.
+func (m *AssetManifest) Names() (names []string) {
+	if m == nil {
+		return
+	}
+	m.RLock()
+	for name := range m.fingerprinted {
+		names = append(names, name)
+	}
+	m.RUnlock()
+	sort.Strings(names)
+	return
+}
+
+// hashFile returns the hex encoded SHA-256 of the file with the given name.
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprintName inserts the first AssetFingerprintLength digits of sum before the extension of name,
+// e.g. "static/app.css" becomes "static/app.3f9a1c0b.css".
+func fingerprintName(name string, sum string) string {
+	if len(sum) > AssetFingerprintLength {
+		sum = sum[:AssetFingerprintLength]
+	}
+	ext := path.Ext(name)
+	if ext == path.Base(name) {
+		// Dot files like ".htaccess" have no extension.
+		ext = ""
+	}
+	return strings.TrimSuffix(name, ext) + "." + sum + ext
+}
+
+// stripFingerprint removes a fingerprint as inserted by fingerprintName from name.
+func stripFingerprint(name string) (string, bool) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	i := strings.LastIndex(base, ".")
+	if i < 0 || len(base)-i-1 != AssetFingerprintLength {
+		return "", false
+	}
+	for _, r := range base[i+1:] {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return "", false
+		}
+	}
+	return base[:i] + ext, true
+}
+
+// Assets returns the AssetManifest of the ViewEngine - nil if the Profile does not cache files or no StaticDirs are set.
+func (v *ViewEngine) Assets() *AssetManifest {
+	return v.assets
+}
+
+// Assets returns the AssetManifest of the current ServerConfig of the App, see ViewEngine.Assets.
+func (a *App) Assets() *AssetManifest {
+	return a.Views().Assets()
+}
+
+// ProvideAssetHandler serves the files of folderRelative like ProvideFolderContentHandler. Requests for a fingerprinted
+// name of the AssetManifest (see the template function asset) are answered with the original file and
+// the AssetCacheControl header, so browsers keep it until the next deploy changes the fingerprint.
+func (a *App) ProvideAssetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, folderRelative string, partToRemoveFromUrlPath string) (err error) {
+	c := a.Config()
+	p := r.URL.Path
+	if c.SubDir != "" {
+		p = strings.Replace(p, c.SubDir, "", 1)
+	}
+	assets := a.Assets()
+	if name, ok := assets.Original(p); ok {
+		w = &cacheControlWriter{ResponseWriter: w, value: AssetCacheControl}
+		r = withURLPath(r, subDirURL(c.SubDir, name))
+	} else if name, ok := stripFingerprint(p); ok {
+		// Pages of an older deploy may still refer to the previous fingerprint - serve the current file, but do not
+		// let it be cached under the old name.
+		if _, ok := assets.Fingerprinted(name); ok {
+			w = &cacheControlWriter{ResponseWriter: w, value: "no-cache"}
+			r = withURLPath(r, subDirURL(c.SubDir, name))
+		}
+	}
+	return a.ProvideFolderContentHandler(ctx, w, r, folderRelative, partToRemoveFromUrlPath, false, "")
+}
+
+// cacheControlWriter sets the Cache-Control header to value when a successful response (2xx or 304) is sent,
+// so error pages of a missing asset are not cached under its fingerprinted name.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < 300 || status == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.value)
+		} else {
+			w.Header().Del("Cache-Control")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying http.ResponseWriter if it supports it.
+func (w *cacheControlWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// GetProvideAssetHandler returns an alice.CtxHandler serving the files of folderRelative by their fingerprinted names,
+// see ProvideAssetHandler.
+func (a *App) GetProvideAssetHandler(folderRelative string, partToRemoveFromUrlPath string) alice.CtxHandler {
+	return alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		a.ProvideAssetHandler(ctx, w, r, folderRelative, partToRemoveFromUrlPath)
+	})
+}
+
+// withURLPath returns a copy of r requesting the given path instead, keeping the query.
+func withURLPath(r *http.Request, p string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path = p
+	u.RawPath = ""
+	r2.URL = &u
+	r2.RequestURI = u.RequestURI()
+	return r2
+}
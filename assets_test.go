@@ -0,0 +1,46 @@
+package webfw
+
+import (
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/net/context"
+)
+
+func TestProvideAssetHandlerCacheControl(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/app.css":  {Data: []byte("body{}")},
+		"static/gone.css": {Data: []byte("p{}")},
+	}
+	a := NewApp(&ServerConfig{RootDir: "/site", Environment: EnvProduction, StaticDirs: []string{"static"}})
+	a.SetFS(fsys)
+	app, _ := a.Assets().Fingerprinted("static/app.css")
+	gone, _ := a.Assets().Fingerprinted("static/gone.css")
+	// Still in the manifest, but missing on disk.
+	delete(fsys, "static/gone.css")
+
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantCache string
+	}{
+		{"/" + app, 200, AssetCacheControl},
+		{"/" + gone, 404, ""},
+		{"/static/app.00000000.css", 200, "no-cache"},
+		{"/static/app.css", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tt.path, nil)
+			a.ProvideAssetHandler(context.Background(), w, r, "static", "/static")
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", cc, tt.wantCache)
+			}
+		})
+	}
+}
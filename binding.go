@@ -0,0 +1,453 @@
+package webfw
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenDriversLog/goodl-lib/translate"
+	"golang.org/x/net/context"
+)
+
+// MaxFormMemory is the number of bytes of a multipart form kept in memory by BindForm, the rest is stored on disk.
+var MaxFormMemory int64 = 32 << 20
+
+// MaxJSONBody is the maximum size of a JSON body decoded by BindForm.
+var MaxJSONBody int64 = 10 << 20
+
+// FormTimeLayouts are tried in order to parse times of a form, after the layouts of the TimeConfig.
+// The first ones match the values of the HTML inputs of type date, datetime-local & time.
+var FormTimeLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", "15:04", time.RFC3339}
+
+// FormDecoder converts the values of a form field into a value of the type it is registered for.
+type FormDecoder func(values []string) (interface{}, error)
+
+var formDecoders = struct {
+	sync.RWMutex
+	m map[reflect.Type]FormDecoder
+}{m: make(map[reflect.Type]FormDecoder)}
+
+// RegisterFormDecoder adds or replaces the FormDecoder for fields of the type of example, e.g.
+//
+//	webfw.RegisterFormDecoder(Money{}, func(values []string) (interface{}, error) { return ParseMoney(values[0]) })
+//
+// Types implementing encoding.TextUnmarshaler need no FormDecoder.
+func RegisterFormDecoder(example interface{}, d FormDecoder) {
+	formDecoders.Lock()
+	formDecoders.m[reflect.TypeOf(example)] = d
+	formDecoders.Unlock()
+}
+
+// getFormDecoder returns the FormDecoder registered for the given type.
+func getFormDecoder(t reflect.Type) (d FormDecoder, ok bool) {
+	formDecoders.RLock()
+	d, ok = formDecoders.m[t]
+	formDecoders.RUnlock()
+	return
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+	unmarshalType  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// BindForm decodes the form (URL-encoded or multipart, including the query) or the JSON body of r into dst,
+// a pointer to a struct, and validates it (see Validate). It returns the FieldErrors of values that could not be
+// converted or are invalid, translated by the Translater of the context - nil if there are none.
+// err is only set if the request or dst can not be decoded at all.
+//
+// Form fields are named by the tag form (the field name if missing, "-" to skip the field). Nested structs are
+// named "address.street", elements of slices of structs "stops[0].name"; other slices take all values of a field.
+// Times are parsed with the tag layout, the formats of the TimeConfig or FormTimeLayouts in TimeConfig.TimeLocation.
+// Fields of type *multipart.FileHeader or []*multipart.FileHeader receive uploaded files.
+// JSON bodies are decoded by encoding/json, errors are named by the tag json.
+//
+//	type TripForm struct {
+//		Title string    `form:"title" validate:"required,max=100"`
+//		Start time.Time `form:"start" layout:"2006-01-02T15:04" validate:"required"`
+//	}
+func (a *App) BindForm(ctx context.Context, r *http.Request, dst interface{}) (errs FieldErrors, err error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("BindForm : %T is no pointer to a struct", dst)
+	}
+	// Invalid tags validate are reported before the body is read.
+	if _, err = rulesFor(v.Elem().Type()); err != nil {
+		return nil, err
+	}
+
+	tagKey := "form"
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "application/json":
+		tagKey = "json"
+		if errs, err = decodeJSON(r, dst); err != nil {
+			return nil, err
+		}
+	case "multipart/form-data":
+		if err = r.ParseMultipartForm(MaxFormMemory); err != nil {
+			return nil, fmt.Errorf("BindForm : %v", err)
+		}
+		d := &formDecoder{tc: a.Config().TimeConfig, values: multipartValues(r), files: r.MultipartForm.File}
+		d.decodeStruct(v.Elem(), "")
+		errs = d.errs
+	default:
+		if err = r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("BindForm : %v", err)
+		}
+		d := &formDecoder{tc: a.Config().TimeConfig, values: r.Form}
+		d.decodeStruct(v.Elem(), "")
+		errs = d.errs
+	}
+
+	failed, err := validateValue(v.Elem(), "", tagKey, errs)
+	if err != nil {
+		return nil, err
+	}
+	errs = append(errs, failed...)
+	if fv, ok := dst.(FormValidator); ok {
+		errs = append(errs, fv.ValidateForm()...)
+	}
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	errs.translate(a.requestTranslater(ctx))
+	return errs, nil
+}
+
+// requestTranslater returns the Translater of the context or the default Translater of the App.
+func (a *App) requestTranslater(ctx context.Context) *translate.Translater {
+	if ctx != nil {
+		if T, ok := ctx.Value("T").(*translate.Translater); ok && T != nil {
+			return T
+		}
+	}
+	return a.DefaultTranslater()
+}
+
+// multipartValues returns the values of the parsed multipart form of r followed by the values of the query,
+// so the body takes precedence like for URL-encoded forms - r.Form has the query first.
+func multipartValues(r *http.Request) map[string][]string {
+	values := make(map[string][]string, len(r.MultipartForm.Value))
+	for k, v := range r.MultipartForm.Value {
+		values[k] = v
+	}
+	for k, v := range r.URL.Query() {
+		values[k] = append(values[k], v...)
+	}
+	return values
+}
+
+// decodeJSON decodes the JSON body of r into dst, returning values of the wrong type as FieldErrors.
+func decodeJSON(r *http.Request, dst interface{}) (errs FieldErrors, err error) {
+	err = json.NewDecoder(http.MaxBytesReader(nil, r.Body, MaxJSONBody)).Decode(dst)
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		return nil, fmt.Errorf("BindForm : JSON body larger than %d bytes", sizeErr.Limit)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return FieldErrors{{Field: typeErr.Field, Rule: "type", Message: invalidValueMessage(typeErr.Type)}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("BindForm : invalid JSON : %v", err)
+	}
+	return nil, nil
+}
+
+// formDecoder decodes form values into structs, collecting the values it can not convert.
+type formDecoder struct {
+	tc     *TimeConfig
+	values map[string][]string
+	files  map[string][]*multipart.FileHeader
+	errs   FieldErrors
+}
+
+// fieldName returns the name of the struct field in forms (tagKey "form") or JSON (tagKey "json") - "" to skip it.
+func fieldName(f reflect.StructField, tagKey string) string {
+	tag := f.Tag.Get(tagKey)
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// joinName returns the name of a field below prefix.
+func joinName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// decodeStruct decodes the fields of the struct v named below prefix.
+func (d *formDecoder) decodeStruct(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("form") == "" {
+			d.decodeStruct(v.Field(i), prefix)
+			continue
+		}
+		name := fieldName(f, "form")
+		if name == "" || f.PkgPath != "" {
+			continue
+		}
+		d.decodeField(v.Field(i), joinName(prefix, name), f.Tag.Get("layout"))
+	}
+}
+
+// hasPrefix returns whether the form contains values or files named name or below it.
+func (d *formDecoder) hasPrefix(name string) bool {
+	for k := range d.values {
+		if k == name || strings.HasPrefix(k, name+".") || strings.HasPrefix(k, name+"[") {
+			return true
+		}
+	}
+	for k := range d.files {
+		if k == name || strings.HasPrefix(k, name+".") || strings.HasPrefix(k, name+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeField decodes the form values named name into v.
+func (d *formDecoder) decodeField(v reflect.Value, name string, layout string) {
+	t := v.Type()
+	if dec, ok := getFormDecoder(t); ok {
+		if values := d.values[name]; len(values) != 0 {
+			x, err := dec(values)
+			if err != nil {
+				d.fail(name, invalidValueMessage(t))
+				return
+			}
+			v.Set(reflect.ValueOf(x))
+		}
+		return
+	}
+	switch {
+	case t == fileHeaderType:
+		if files := d.files[name]; len(files) != 0 {
+			v.Set(reflect.ValueOf(files[0]))
+		}
+		return
+	case t.Kind() == reflect.Slice && t.Elem() == fileHeaderType:
+		if files := d.files[name]; len(files) != 0 {
+			v.Set(reflect.ValueOf(files))
+		}
+		return
+	case t == timeType || reflect.PtrTo(t).Implements(unmarshalType):
+		if values := d.values[name]; len(values) != 0 {
+			d.decodeValue(v, name, values[0], layout)
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if !d.hasPrefix(name) {
+			return
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		d.decodeField(v.Elem(), name, layout)
+	case reflect.Struct:
+		d.decodeStruct(v, name)
+	case reflect.Slice:
+		if k := t.Elem().Kind(); k == reflect.Struct || k == reflect.Ptr {
+			d.decodeStructSlice(v, name)
+			return
+		}
+		values, ok := d.values[name]
+		if !ok {
+			values, ok = d.values[name+"[]"]
+		}
+		if !ok {
+			return
+		}
+		s := reflect.MakeSlice(t, 0, len(values))
+		for _, val := range values {
+			if val == "" {
+				continue
+			}
+			e := reflect.New(t.Elem()).Elem()
+			if d.decodeValue(e, name, val, layout) {
+				s = reflect.Append(s, e)
+			}
+		}
+		v.Set(s)
+	default:
+		if values := d.values[name]; len(values) != 0 {
+			d.decodeValue(v, name, values[0], layout)
+		}
+	}
+}
+
+// decodeStructSlice decodes the elements named name[0], name[1]... into the slice v.
+func (d *formDecoder) decodeStructSlice(v reflect.Value, name string) {
+	indices := make(map[int]bool)
+	for _, m := range []map[string][]string{d.values, fileNames(d.files)} {
+		for k := range m {
+			if !strings.HasPrefix(k, name+"[") {
+				continue
+			}
+			end := strings.Index(k[len(name)+1:], "]")
+			if end < 0 {
+				continue
+			}
+			if i, err := strconv.Atoi(k[len(name)+1 : len(name)+1+end]); err == nil && i >= 0 && i < MaxFormSliceLen {
+				indices[i] = true
+			}
+		}
+	}
+	if len(indices) == 0 {
+		return
+	}
+	sorted := make([]int, 0, len(indices))
+	for i := range indices {
+		sorted = append(sorted, i)
+	}
+	sort.Ints(sorted)
+	s := reflect.MakeSlice(v.Type(), sorted[len(sorted)-1]+1, sorted[len(sorted)-1]+1)
+	reflect.Copy(s, v)
+	for _, i := range sorted {
+		d.decodeField(s.Index(i), name+"["+strconv.Itoa(i)+"]", "")
+	}
+	v.Set(s)
+}
+
+// MaxFormSliceLen limits the indices of slices of structs decoded by BindForm.
+var MaxFormSliceLen = 1000
+
+// fileNames returns the names of the given files as keys of a map.
+func fileNames(files map[string][]*multipart.FileHeader) map[string][]string {
+	m := make(map[string][]string, len(files))
+	for k := range files {
+		m[k] = nil
+	}
+	return m
+}
+
+// decodeValue converts the single value s into v. It returns false & records a FieldError if it is invalid.
+func (d *formDecoder) decodeValue(v reflect.Value, name string, s string, layout string) bool {
+	t := v.Type()
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok && t != timeType {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			d.fail(name, invalidValueMessage(t))
+			return false
+		}
+		return true
+	}
+	s = strings.TrimSpace(s)
+	if s == "" && t.Kind() != reflect.String {
+		// Empty inputs keep the zero value - use the rule required to demand a value.
+		return true
+	}
+	var err error
+	switch {
+	case t == timeType:
+		var tm time.Time
+		if tm, err = d.parseTime(s, layout); err == nil {
+			v.Set(reflect.ValueOf(tm))
+		}
+	case t.Kind() == reflect.String:
+		v.SetString(s)
+	case t.Kind() == reflect.Bool:
+		switch strings.ToLower(s) {
+		case "on", "yes", "true", "1":
+			v.SetBool(true)
+		case "off", "no", "false", "0":
+			v.SetBool(false)
+		default:
+			err = errors.New("no bool")
+		}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, t.Bits()); err == nil {
+			v.SetInt(i)
+		}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		var u uint64
+		if u, err = strconv.ParseUint(s, 10, t.Bits()); err == nil {
+			v.SetUint(u)
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(strings.Replace(s, ",", ".", 1), t.Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	default:
+		err = fmt.Errorf("unsupported type %v", t)
+	}
+	if err != nil {
+		d.fail(name, invalidValueMessage(t))
+		return false
+	}
+	return true
+}
+
+// parseTime parses s using the given layout or, if empty, the layouts of the TimeConfig & FormTimeLayouts.
+func (d *formDecoder) parseTime(s string, layout string) (time.Time, error) {
+	loc := time.UTC
+	var layouts []string
+	if tc := d.tc; tc != nil {
+		if tc.TimeLocation != nil {
+			loc = tc.TimeLocation
+		}
+		layouts = append(layouts, tc.LongTimeFormatString, tc.ShortTimeFormatString, tc.FileTimeFormatString)
+	}
+	if layout != "" {
+		layouts = []string{layout}
+	} else {
+		layouts = append(layouts, FormTimeLayouts...)
+	}
+	for _, l := range layouts {
+		if l == "" {
+			continue
+		}
+		if tm, err := time.ParseInLocation(l, s, loc); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q matches no time layout", s)
+}
+
+// fail records that the value of the field with the given name is invalid.
+func (d *formDecoder) fail(name string, message string) {
+	d.errs = append(d.errs, &FieldError{Field: name, Rule: "type", Message: message})
+}
+
+// invalidValueMessage returns the message for a value that can not be converted into the given type.
+func invalidValueMessage(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return "Please enter a valid date."
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return "Please enter a whole number."
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "Please enter a number."
+	}
+	return "Please enter a valid value."
+}
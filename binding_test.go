@@ -0,0 +1,180 @@
+package webfw
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type bindTestAddress struct {
+	Street string `form:"street" json:"street" validate:"required"`
+	City   string `form:"city" json:"city"`
+}
+
+type bindTestStop struct {
+	Name string `form:"name" json:"name" validate:"required"`
+	Km   int    `form:"km" json:"km"`
+}
+
+type bindTestForm struct {
+	Title   string           `form:"title" json:"title" validate:"required,max=10"`
+	Count   int              `form:"count" json:"count" validate:"min=1"`
+	Price   float64          `form:"price" json:"price"`
+	Active  bool             `form:"active" json:"active"`
+	Start   time.Time        `form:"start" json:"start" layout:"2006-01-02"`
+	Tags    []string         `form:"tags" json:"tags"`
+	Ids     []int            `form:"ids" json:"ids"`
+	Address bindTestAddress  `form:"address" json:"address"`
+	Billing *bindTestAddress `form:"billing" json:"billing"`
+	Stops   []bindTestStop   `form:"stops" json:"stops"`
+	Skip    string           `form:"-" json:"-"`
+}
+
+// fieldErrorNames returns "field:rule" for each of the given errors.
+func fieldErrorNames(errs FieldErrors) (names []string) {
+	for _, e := range errs {
+		names = append(names, e.Field+":"+e.Rule)
+	}
+	return
+}
+
+func TestBindFormURLEncoded(t *testing.T) {
+	valid := url.Values{"title": {"Trip"}, "count": {"2"}, "address.street": {"Main St"}}
+	with := func(kv ...string) url.Values {
+		v := url.Values{}
+		for k, vals := range valid {
+			v[k] = vals
+		}
+		for i := 0; i < len(kv); i += 2 {
+			v[kv[i]] = append(v[kv[i]], kv[i+1])
+		}
+		return v
+	}
+	tests := []struct {
+		name       string
+		form       url.Values
+		want       func(f *bindTestForm) bool
+		wantErrors []string
+	}{
+		{"valid", valid, func(f *bindTestForm) bool {
+			return f.Title == "Trip" && f.Count == 2 && f.Address.Street == "Main St" && f.Billing == nil && f.Stops == nil
+		}, nil},
+		{"numbers, bool & time", with("price", "1,5", "active", "on", "start", "2016-03-01"), func(f *bindTestForm) bool {
+			return f.Price == 1.5 && f.Active && f.Start.Equal(time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC))
+		}, nil},
+		{"slices", with("tags", "a", "tags", "b", "ids[]", "1", "ids[]", "", "ids[]", "3"), func(f *bindTestForm) bool {
+			return reflect.DeepEqual(f.Tags, []string{"a", "b"}) && reflect.DeepEqual(f.Ids, []int{1, 3})
+		}, nil},
+		{"pointer to nested struct", with("billing.street", "Side St"), func(f *bindTestForm) bool {
+			return f.Billing != nil && f.Billing.Street == "Side St"
+		}, nil},
+		{"slice of structs", with("stops[0].name", "A", "stops[2].name", "C", "stops[2].km", "7"), func(f *bindTestForm) bool {
+			return len(f.Stops) == 3 && f.Stops[0].Name == "A" && f.Stops[2] == bindTestStop{"C", 7}
+		}, []string{"stops[1].name:required"}},
+		{"skipped field", with("Skip", "x", "-", "x"), func(f *bindTestForm) bool { return f.Skip == "" }, nil},
+		{"type errors", with("price", "cheap", "active", "maybe", "start", "March", "ids", "x"), nil,
+			[]string{"price:type", "active:type", "start:type", "ids:type"}},
+		{"zero passes min", url.Values{"title": {"Trip"}, "count": {"0"}, "address.street": {"x"}},
+			func(f *bindTestForm) bool { return f.Count == 0 }, nil},
+		{"type error skips rules", url.Values{"title": {"Trip"}, "count": {"none"}, "address.street": {"x"}}, nil,
+			[]string{"count:type"}},
+		{"validation errors", url.Values{"title": {strings.Repeat("x", 11)}, "count": {"-1"}, "billing.city": {"X"}}, nil,
+			[]string{"title:max", "count:min", "address.street:required", "billing.street:required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/trips", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			var f bindTestForm
+			errs, err := NewApp(&ServerConfig{}).BindForm(context.Background(), r, &f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fieldErrorNames(errs); !reflect.DeepEqual(got, tt.wantErrors) {
+				t.Errorf("errors = %v, want %v", got, tt.wantErrors)
+			}
+			if tt.want != nil && !tt.want(&f) {
+				t.Errorf("decoded %+v", f)
+			}
+		})
+	}
+}
+
+func TestBindFormJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantErrors []string
+		wantErr    bool
+	}{
+		{"valid", `{"title": "Trip", "count": 2, "address": {"street": "Main St"}, "stops": [{"name": "A"}]}`, nil, false},
+		{"named by json", `{"title": "Trip", "count": 2, "address": {}, "stops": [{"name": ""}]}`,
+			[]string{"address.street:required", "stops[0].name:required"}, false},
+		{"wrong type", `{"title": "Trip", "count": "2", "address": {"street": "Main St"}}`, []string{"count:type"}, false},
+		{"invalid JSON", `{"title": `, nil, true},
+		{"too large", `{"title": "` + strings.Repeat("x", 100) + `"}`, nil, true},
+	}
+	defer func(max int64) { MaxJSONBody = max }(MaxJSONBody)
+	MaxJSONBody = 100
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/trips", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json; charset=utf-8")
+			var f bindTestForm
+			errs, err := NewApp(&ServerConfig{}).BindForm(context.Background(), r, &f)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got := fieldErrorNames(errs); !reflect.DeepEqual(got, tt.wantErrors) {
+				t.Errorf("errors = %v, want %v", got, tt.wantErrors)
+			}
+		})
+	}
+}
+
+type bindTestUpload struct {
+	Title string                  `form:"title"`
+	File  *multipart.FileHeader   `form:"file" validate:"required"`
+	More  []*multipart.FileHeader `form:"more"`
+}
+
+func TestBindFormMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "Upload")
+	for _, name := range []string{"file", "more", "more"} {
+		fw, _ := mw.CreateFormFile(name, name+".txt")
+		fw.Write([]byte("content"))
+	}
+	mw.Close()
+	r := httptest.NewRequest("POST", "/upload?title=ignored", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var f bindTestUpload
+	errs, err := NewApp(&ServerConfig{}).BindForm(context.Background(), r, &f)
+	if err != nil || errs != nil {
+		t.Fatal(err, errs)
+	}
+	if f.Title != "Upload" || f.File == nil || f.File.Filename != "file.txt" || len(f.More) != 2 {
+		t.Errorf("decoded %+v", f)
+	}
+}
+
+func TestBindFormInvalidTarget(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	var bad struct {
+		Name string `validate:"unknown"`
+	}
+	for _, dst := range []interface{}{bindTestForm{}, new(string), &bad} {
+		if _, err := NewApp(&ServerConfig{}).BindForm(context.Background(), r, dst); err == nil {
+			t.Errorf("BindForm(%T) returned no error", dst)
+		}
+	}
+}
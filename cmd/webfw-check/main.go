@@ -0,0 +1,42 @@
+// webfw-check checks a webfw-site before it is deployed : it loads the ServerConfig from the given file,
+// parses every shared template and view and checks that Redis answers.
+// It prints a report and exits non-zero if anything failed.
+//
+// As this command does not know the MVCBinders of your site, also call webfw.RunPreflight from your own binary
+// (e.g. behind a -check flag) to check the views they declare.
+//
+// Usage :
+//
+//	webfw-check -config /etc/goodl/webfw.yaml [-no-redis]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/OpenDriversLog/webfw"
+)
+
+func main() {
+	configPath := flag.String("config", "", "path of the JSON, YAML or TOML config file")
+	noRedis := flag.Bool("no-redis", false, "do not check whether Redis answers")
+	flag.Parse()
+
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "webfw-check : -config is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	c, err := webfw.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "FAIL  config :", err)
+		os.Exit(1)
+	}
+
+	r := webfw.PreflightWithOptions(webfw.NewApp(c), webfw.PreflightOptions{SkipRedis: *noRedis})
+	r.Print(os.Stdout)
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,348 @@
+package webfw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Compufreak345/dbg"
+	"gopkg.in/yaml.v2"
+)
+
+const cfTag = dbg.Tag("webfw/configfile.go")
+
+// EnvPrefix is the prefix of all environment variables overriding values of a loaded ServerConfig.
+const EnvPrefix = "WEBFW_"
+
+// serverConfigFile is the on-disk representation of a ServerConfig.
+// Durations and the time location are kept as strings until they are validated.
+// Values are pointers, so a value missing in the file keeps its default while an empty one clears it.
+type serverConfigFile struct {
+	RootDir          *string           `json:"RootDir" yaml:"RootDir" toml:"RootDir"`
+	MaxResponseTime  *string           `json:"MaxResponseTime" yaml:"MaxResponseTime" toml:"MaxResponseTime"`
+	TimeoutMessage   *string           `json:"TimeoutMessage" yaml:"TimeoutMessage" toml:"TimeoutMessage"`
+	TimeConfig       *timeConfigFile   `json:"TimeConfig" yaml:"TimeConfig" toml:"TimeConfig"`
+	RedisAddress     *string           `json:"RedisAddress" yaml:"RedisAddress" toml:"RedisAddress"`
+	HttpAddress      *string           `json:"HttpAddress" yaml:"HttpAddress" toml:"HttpAddress"`
+	SharedDir        *string           `json:"SharedDir" yaml:"SharedDir" toml:"SharedDir"`
+	Version          *string           `json:"Version" yaml:"Version" toml:"Version"`
+	SubDir           *string           `json:"SubDir" yaml:"SubDir" toml:"SubDir"`
+	WebUrl           *string           `json:"WebUrl" yaml:"WebUrl" toml:"WebUrl"`
+	GitLabPath       *string           `json:"GitLabPath" yaml:"GitLabPath" toml:"GitLabPath"`
+	SmtpHost         *string           `json:"SmtpHost" yaml:"SmtpHost" toml:"SmtpHost"`
+	SmtpPort         *string           `json:"SmtpPort" yaml:"SmtpPort" toml:"SmtpPort"`
+	SmtpUser         *string           `json:"SmtpUser" yaml:"SmtpUser" toml:"SmtpUser"`
+	SmtpPassword     *string           `json:"SmtpPassword" yaml:"SmtpPassword" toml:"SmtpPassword"`
+	SmtpFrom         *string           `json:"SmtpFrom" yaml:"SmtpFrom" toml:"SmtpFrom"`
+	StaticDirs       []string          `json:"StaticDirs" yaml:"StaticDirs" toml:"StaticDirs"`
+	Environment      *string           `json:"Environment" yaml:"Environment" toml:"Environment"`
+	ProfileOverrides *ProfileOverrides `json:"ProfileOverrides" yaml:"ProfileOverrides" toml:"ProfileOverrides"`
+}
+
+// timeConfigFile is the on-disk representation of a TimeConfig.
+type timeConfigFile struct {
+	LongTimeFormatString  *string `json:"LongTimeFormatString" yaml:"LongTimeFormatString" toml:"LongTimeFormatString"`
+	ShortTimeFormatString *string `json:"ShortTimeFormatString" yaml:"ShortTimeFormatString" toml:"ShortTimeFormatString"`
+	FileTimeFormatString  *string `json:"FileTimeFormatString" yaml:"FileTimeFormatString" toml:"FileTimeFormatString"`
+	TimeLocation          *string `json:"TimeLocation" yaml:"TimeLocation" toml:"TimeLocation"`
+}
+
+// ConfigErrors contains every problem found while loading or validating a ServerConfig.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid server config (%d problems) :\n\t%s", len(e), strings.Join(msgs, "\n\t"))
+}
+
+// LoadServerConfig reads the ServerConfig from the given JSON, YAML or TOML file (determined by its extension),
+// applies the WEBFW_* environment overrides and validates the result.
+// Values missing in the file keep their defaults, empty values clear them - a missing or empty RootDir
+// defaults to the directory of the file. Unknown keys are reported as errors.
+// Relative RootDir & SharedDir are resolved against the directory of the file.
+// If anything is wrong, a ConfigErrors containing all problems is returned.
+func LoadServerConfig(path string) (c *ServerConfig, err error) {
+	dbg.D(cfTag, "Start LoadServerConfig for %s", path)
+	f := &serverConfigFile{}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		dbg.W(cfTag, "Could not read config file %s : %v", path, err)
+		return nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(f)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(raw, f)
+	case ".toml":
+		var md toml.MetaData
+		if md, err = toml.Decode(string(raw), f); err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) != 0 {
+				keys := make([]string, len(undecoded))
+				for i, k := range undecoded {
+					keys[i] = k.String()
+				}
+				err = fmt.Errorf("unknown keys %s", strings.Join(keys, ", "))
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown config file extension %q, use .json, .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		dbg.W(cfTag, "Could not parse config file %s : %v", path, err)
+		return nil, err
+	}
+	envErrs := f.applyEnv(os.LookupEnv)
+
+	baseDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	c, errs := f.toServerConfig(baseDir)
+	errs = append(envErrs, errs...)
+	if err = c.Validate(); err != nil {
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+	if len(errs) != 0 {
+		dbg.W(cfTag, "End LoadServerConfig with errors : %v", errs)
+		return nil, errs
+	}
+	dbg.D(cfTag, "End LoadServerConfig")
+	return c, nil
+}
+
+// applyEnv overrides the values of the file with the WEBFW_* environment variables, e.g. WEBFW_REDIS_ADDRESS.
+func (f *serverConfigFile) applyEnv(lookup func(string) (string, bool)) (errs ConfigErrors) {
+	if f.TimeConfig == nil {
+		f.TimeConfig = &timeConfigFile{}
+	}
+	vars := map[string]**string{
+		"ROOT_DIR":          &f.RootDir,
+		"MAX_RESPONSE_TIME": &f.MaxResponseTime,
+		"TIMEOUT_MESSAGE":   &f.TimeoutMessage,
+		"REDIS_ADDRESS":     &f.RedisAddress,
+		"HTTP_ADDRESS":      &f.HttpAddress,
+		"SHARED_DIR":        &f.SharedDir,
+		"VERSION":           &f.Version,
+		"WEB_URL":           &f.WebUrl,
+		"GITLAB_PATH":       &f.GitLabPath,
+		"SMTP_HOST":         &f.SmtpHost,
+		"SMTP_PORT":         &f.SmtpPort,
+		"SMTP_USER":         &f.SmtpUser,
+		"SMTP_PASSWORD":     &f.SmtpPassword,
+		"SMTP_FROM":         &f.SmtpFrom,
+		"SUB_DIR":           &f.SubDir,
+		"ENVIRONMENT":       &f.Environment,
+		"LONG_TIME_FORMAT":  &f.TimeConfig.LongTimeFormatString,
+		"SHORT_TIME_FORMAT": &f.TimeConfig.ShortTimeFormatString,
+		"FILE_TIME_FORMAT":  &f.TimeConfig.FileTimeFormatString,
+		"TIME_LOCATION":     &f.TimeConfig.TimeLocation,
+	}
+	for name, target := range vars {
+		// Set to "", a variable clears the value.
+		if val, ok := lookup(EnvPrefix + name); ok {
+			dbg.D(cfTag, "Config value %s overridden by environment", EnvPrefix+name)
+			*target = &val
+		}
+	}
+
+	// Single settings of the profile
+	if f.ProfileOverrides == nil {
+		f.ProfileOverrides = &ProfileOverrides{}
+	}
+	o := f.ProfileOverrides
+	for name, target := range map[string]**bool{
+		"CACHE_TEMPLATES": &o.CacheTemplates,
+		"WATCH_TEMPLATES": &o.WatchTemplates,
+		"CACHE_FILES":     &o.CacheFiles,
+	} {
+		if val, ok := lookup(EnvPrefix + name); ok {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s : %v", EnvPrefix+name, err))
+				continue
+			}
+			*target = &b
+		}
+	}
+	for name, target := range map[string]**string{
+		"ERROR_DETAIL":      &o.ErrorDetail,
+		"ACCESS_LOG_FORMAT": &o.AccessLogFormat,
+	} {
+		if val, ok := lookup(EnvPrefix + name); ok {
+			*target = &val
+		}
+	}
+	return
+}
+
+// toServerConfig converts the file representation to a ServerConfig based on the defaults,
+// collecting all values that could not be parsed.
+func (f *serverConfigFile) toServerConfig(baseDir string) (c *ServerConfig, errs ConfigErrors) {
+	c = defaultServerConfig()
+	c.RootDir = baseDir
+
+	setStr := func(target *string, val *string) {
+		if val != nil {
+			*target = *val
+		}
+	}
+	if f.RootDir != nil && *f.RootDir != "" {
+		c.RootDir = resolvePath(baseDir, *f.RootDir)
+	}
+	if f.SharedDir != nil {
+		c.SharedDir = ""
+		if *f.SharedDir != "" {
+			c.SharedDir = resolvePath(baseDir, *f.SharedDir)
+		}
+	}
+	if f.MaxResponseTime != nil {
+		d, err := time.ParseDuration(*f.MaxResponseTime)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("MaxResponseTime : %v", err))
+		} else {
+			c.MaxResponseTime = d
+		}
+	}
+	setStr(&c.SubDir, f.SubDir)
+	setStr(&c.TimeoutMessage, f.TimeoutMessage)
+	setStr(&c.RedisAddress, f.RedisAddress)
+	setStr(&c.HttpAddress, f.HttpAddress)
+	setStr(&c.Version, f.Version)
+	setStr(&c.WebUrl, f.WebUrl)
+	setStr(&c.GitLabPath, f.GitLabPath)
+	setStr(&c.SmtpHost, f.SmtpHost)
+	setStr(&c.SmtpPort, f.SmtpPort)
+	setStr(&c.SmtpUser, f.SmtpUser)
+	setStr(&c.SmtpPassword, f.SmtpPassword)
+	setStr(&c.SmtpFrom, f.SmtpFrom)
+	setStr(&c.Environment, f.Environment)
+	c.ProfileOverrides = f.ProfileOverrides
+	c.StaticDirs = f.StaticDirs
+
+	if tc := f.TimeConfig; tc != nil {
+		setStr(&c.TimeConfig.LongTimeFormatString, tc.LongTimeFormatString)
+		setStr(&c.TimeConfig.ShortTimeFormatString, tc.ShortTimeFormatString)
+		setStr(&c.TimeConfig.FileTimeFormatString, tc.FileTimeFormatString)
+		if tc.TimeLocation != nil {
+			loc, err := time.LoadLocation(*tc.TimeLocation)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("TimeConfig.TimeLocation : %v", err))
+			} else {
+				c.TimeConfig.TimeLocation = loc
+			}
+		}
+	}
+	return
+}
+
+// resolvePath returns p if it is absolute, otherwise p relative to baseDir.
+func resolvePath(baseDir string, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(baseDir, p)
+}
+
+// Validate checks the ServerConfig for values that would make the server fail at request time.
+// It returns nil or a ConfigErrors containing all problems.
+func (c *ServerConfig) Validate() error {
+	return c.validate(true)
+}
+
+// validate is Validate, checkDirs is false if the files are not read from disk (see App.SetFS).
+func (c *ServerConfig) validate(checkDirs bool) error {
+	var errs ConfigErrors
+	checkDir := func(name string, dir string) {
+		if !checkDirs {
+			return
+		}
+		fi, err := os.Stat(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s : %v", name, err))
+		} else if !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("%s : %s is not a directory", name, dir))
+		}
+	}
+
+	if c.RootDir == "" {
+		errs = append(errs, errors.New("RootDir : must not be empty"))
+	} else {
+		checkDir("RootDir", c.RootDir)
+	}
+	if c.SharedDir != "" {
+		checkDir("SharedDir", c.SharedDir)
+	}
+	for _, dir := range c.StaticDirs {
+		if filepath.IsAbs(dir) || strings.HasPrefix(filepath.Clean(dir), "..") {
+			errs = append(errs, fmt.Errorf("StaticDirs : %q must be relative to RootDir", dir))
+		} else if c.RootDir != "" {
+			checkDir("StaticDirs", filepath.Join(c.RootDir, dir))
+		}
+	}
+	if c.MaxResponseTime <= 0 {
+		errs = append(errs, fmt.Errorf("MaxResponseTime : must be positive, is %v", c.MaxResponseTime))
+	}
+	if c.HttpAddress == "" {
+		errs = append(errs, errors.New("HttpAddress : must not be empty"))
+	}
+	if c.RedisAddress == "" {
+		errs = append(errs, errors.New("RedisAddress : must not be empty"))
+	}
+	if c.SubDir != "" && (!strings.HasPrefix(c.SubDir, "/") || strings.HasSuffix(c.SubDir, "/")) {
+		errs = append(errs, fmt.Errorf("SubDir : %q must start and must not end with \"/\"", c.SubDir))
+	}
+	if c.WebUrl != "" {
+		if u, err := url.Parse(c.WebUrl); err != nil {
+			errs = append(errs, fmt.Errorf("WebUrl : %v", err))
+		} else if u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("WebUrl : %q must be an absolute URL", c.WebUrl))
+		}
+	}
+	if c.SmtpPort != "" {
+		if p, err := strconv.Atoi(c.SmtpPort); err != nil || p <= 0 || p > 65535 {
+			errs = append(errs, fmt.Errorf("SmtpPort : %q is not a valid port", c.SmtpPort))
+		}
+	}
+	if c.SmtpFrom != "" {
+		if _, err := mail.ParseAddress(c.SmtpFrom); err != nil {
+			errs = append(errs, fmt.Errorf("SmtpFrom : %v", err))
+		}
+	}
+	if tc := c.TimeConfig; tc == nil {
+		errs = append(errs, errors.New("TimeConfig : must not be nil"))
+	} else {
+		if tc.LongTimeFormatString == "" {
+			errs = append(errs, errors.New("TimeConfig.LongTimeFormatString : must not be empty"))
+		}
+		if tc.ShortTimeFormatString == "" {
+			errs = append(errs, errors.New("TimeConfig.ShortTimeFormatString : must not be empty"))
+		}
+		if tc.FileTimeFormatString == "" {
+			errs = append(errs, errors.New("TimeConfig.FileTimeFormatString : must not be empty"))
+		}
+		if tc.TimeLocation == nil {
+			errs = append(errs, errors.New("TimeConfig.TimeLocation : must not be nil"))
+		}
+	}
+	errs = append(errs, c.validateProfile()...)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package webfw
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a config file with the given name & content into a new directory.
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadServerConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"webfw.json": `{"HttpAddress": ":8080", "SubDir": "", "MaxResponseTime": "5s",
+			"TimeConfig": {"TimeLocation": "UTC"}, "StaticDirs": ["."]}`,
+		"webfw.yaml": "HttpAddress: \":8080\"\nSubDir: \"\"\nMaxResponseTime: 5s\nTimeConfig:\n  TimeLocation: UTC\nStaticDirs: [\".\"]\n",
+		"webfw.toml": "HttpAddress = \":8080\"\nSubDir = \"\"\nMaxResponseTime = \"5s\"\nStaticDirs = [\".\"]\n[TimeConfig]\nTimeLocation = \"UTC\"\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			p := writeConfigFile(t, name, content)
+			c, err := LoadServerConfig(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.HttpAddress != ":8080" || c.MaxResponseTime != 5*time.Second || c.TimeConfig.TimeLocation != time.UTC {
+				t.Errorf("values of the file not set : %+v", c)
+			}
+			// Missing values keep their defaults, empty ones clear them.
+			if c.RedisAddress != ":6379" || c.SmtpPort != "587" {
+				t.Errorf("defaults not kept : %+v", c)
+			}
+			if c.SubDir != "" {
+				t.Errorf("SubDir = %q, want it cleared", c.SubDir)
+			}
+			if c.RootDir != filepath.Dir(p) {
+				t.Errorf("RootDir = %q, want the directory of the file %q", c.RootDir, filepath.Dir(p))
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigRejectsUnknownKeys(t *testing.T) {
+	files := map[string]string{
+		"webfw.json": `{"HttpAdress": ":8080"}`,
+		"webfw.yaml": "HttpAdress: \":8080\"\n",
+		"webfw.toml": "HttpAdress = \":8080\"\n",
+		"webfw.ini":  "HttpAddress = :8080\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadServerConfig(writeConfigFile(t, name, content)); err == nil {
+				t.Error("LoadServerConfig returned no error")
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigEnv(t *testing.T) {
+	t.Setenv(EnvPrefix+"HTTP_ADDRESS", ":9090")
+	t.Setenv(EnvPrefix+"SMTP_HOST", "")
+	t.Setenv(EnvPrefix+"CACHE_TEMPLATES", "false")
+	c, err := LoadServerConfig(writeConfigFile(t, "webfw.json", `{"HttpAddress": ":8080"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.HttpAddress != ":9090" || c.SmtpHost != "" {
+		t.Errorf("environment not applied : %+v", c)
+	}
+	if o := c.ProfileOverrides; o == nil || o.CacheTemplates == nil || *o.CacheTemplates {
+		t.Errorf("ProfileOverrides = %+v, want CacheTemplates false", o)
+	}
+
+	t.Setenv(EnvPrefix+"CACHE_TEMPLATES", "maybe")
+	if _, err := LoadServerConfig(writeConfigFile(t, "webfw.json", `{}`)); err == nil {
+		t.Error("invalid boolean in the environment accepted")
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		modify  func(c *ServerConfig)
+		wantErr string
+	}{
+		{"valid", func(c *ServerConfig) {}, ""},
+		{"empty RootDir", func(c *ServerConfig) { c.RootDir = "" }, "RootDir"},
+		{"missing RootDir", func(c *ServerConfig) { c.RootDir = filepath.Join(dir, "missing") }, "RootDir"},
+		{"absolute StaticDir", func(c *ServerConfig) { c.StaticDirs = []string{dir} }, "StaticDirs"},
+		{"StaticDir outside RootDir", func(c *ServerConfig) { c.StaticDirs = []string{"../x"} }, "StaticDirs"},
+		{"MaxResponseTime", func(c *ServerConfig) { c.MaxResponseTime = 0 }, "MaxResponseTime"},
+		{"HttpAddress", func(c *ServerConfig) { c.HttpAddress = "" }, "HttpAddress"},
+		{"RedisAddress", func(c *ServerConfig) { c.RedisAddress = "" }, "RedisAddress"},
+		{"SubDir without slash", func(c *ServerConfig) { c.SubDir = "alpha" }, "SubDir"},
+		{"SubDir with trailing slash", func(c *ServerConfig) { c.SubDir = "/alpha/" }, "SubDir"},
+		{"relative WebUrl", func(c *ServerConfig) { c.WebUrl = "/odl" }, "WebUrl"},
+		{"SmtpPort", func(c *ServerConfig) { c.SmtpPort = "70000" }, "SmtpPort"},
+		{"SmtpFrom", func(c *ServerConfig) { c.SmtpFrom = "not an address" }, "SmtpFrom"},
+		{"TimeConfig", func(c *ServerConfig) { c.TimeConfig = nil }, "TimeConfig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultServerConfig()
+			c.RootDir = dir
+			tt.modify(c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			errs, ok := err.(ConfigErrors)
+			if !ok || len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want a single error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -9,10 +9,20 @@ import (
 )
 
 // Controller is the core controller determing which view to use, what data to display and how to handle the data.
+// vSharedTemplate may combine a base layout with partial sets, see Layout.
+// If the client asks for JSON, XML, CSV... instead of HTML, the ViewData is serialized instead, see Renderer.
 type Controller interface {
 	GetViewData(ctx context.Context, r *http.Request) (vd ViewData, vPath string, vSharedTemplate string, err error)
 }
 
+// ControllerFunc lets an ordinary function be used as Controller.
+type ControllerFunc func(ctx context.Context, r *http.Request) (vd ViewData, vPath string, vSharedTemplate string, err error)
+
+// GetViewData calls f(ctx, r).
+func (f ControllerFunc) GetViewData(ctx context.Context, r *http.Request) (vd ViewData, vPath string, vSharedTemplate string, err error) {
+	return f(ctx, r)
+}
+
 // ErrorController is used when an error is used, to show an error message.
 type ErrorController interface {
 	GetViewData(vd ViewData, errIn error) (vdNew ViewData, vPath string, vSharedTemplate string, err error)
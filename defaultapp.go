@@ -0,0 +1,182 @@
+package webfw
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Compufreak345/alice"
+	"github.com/OpenDriversLog/goodl-lib/translate"
+	"golang.org/x/net/context"
+)
+
+// The package-level functions below are thin wrappers calling the default App - see DefaultApp.
+
+// DefaultTranslater returns the default translater of the default App (if not set, currently "de-DE")
+func DefaultTranslater() *translate.Translater {
+	return defaultApp.DefaultTranslater()
+}
+
+// SetDefaultTranslater sets the default translater of the default App.
+func SetDefaultTranslater(t *translate.Translater) {
+	defaultApp.SetDefaultTranslater(t)
+}
+
+// GetMvcHandler returns a an alice.CtxHandler that is able to serve MVC-pages of the default App.
+func GetMvcHandler(binderKey string, viewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string) alice.CtxHandler {
+	return defaultApp.GetMvcHandler(binderKey, viewDataPolishFunc)
+}
+
+func GetProvideFolderContentHandler(folderRelative string, partToRemoveFromUrlPath string) alice.CtxHandler {
+	return defaultApp.GetProvideFolderContentHandler(folderRelative, partToRemoveFromUrlPath)
+}
+
+// GetProvideFSContentHandler returns an alice.CtxHandler serving the files of the given fs.FS using the default App.
+func GetProvideFSContentHandler(fsys fs.FS, partToRemoveFromUrlPath string) alice.CtxHandler {
+	return defaultApp.GetProvideFSContentHandler(fsys, partToRemoveFromUrlPath)
+}
+
+// GetProvideAssetHandler returns an alice.CtxHandler serving the files of folderRelative by their fingerprinted names
+// using the default App, see App.ProvideAssetHandler.
+func GetProvideAssetHandler(folderRelative string, partToRemoveFromUrlPath string) alice.CtxHandler {
+	return defaultApp.GetProvideAssetHandler(folderRelative, partToRemoveFromUrlPath)
+}
+
+// ProvideAssetHandler serves the files of folderRelative by their fingerprinted names using the default App.
+func ProvideAssetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, folderRelative string, partToRemoveFromUrlPath string) (err error) {
+	return defaultApp.ProvideAssetHandler(ctx, w, r, folderRelative, partToRemoveFromUrlPath)
+}
+
+func DirectShowError_NoVD(ctx context.Context, w http.ResponseWriter, r *http.Request, err error, errorMessage string, errorType int, notStyled ...bool) {
+	defaultApp.DirectShowError_NoVD(ctx, w, r, err, errorMessage, errorType, notStyled...)
+}
+
+func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, folderRelative string, partToRemoveFromUrlPath string, asDownload bool, folderAbsolute string) (err error) {
+	return defaultApp.ProvideFolderContentHandler(ctx, w, r, folderRelative, partToRemoveFromUrlPath, asDownload, folderAbsolute)
+}
+
+// ProvideFSContentHandler serves the files of the given fs.FS using the default App.
+func ProvideFSContentHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, fsys fs.FS, partToRemoveFromUrlPath string, asDownload bool) (err error) {
+	return defaultApp.ProvideFSContentHandler(ctx, w, r, fsys, partToRemoveFromUrlPath, asDownload)
+}
+
+// SetFS lets the default App read its files from the given fs.FS - see App.SetFS.
+func SetFS(fsys fs.FS) {
+	defaultApp.SetFS(fsys)
+}
+
+// SetViewOptions sets the ViewOptions of the default App - see App.SetViewOptions.
+func SetViewOptions(o ViewOptions) error {
+	return defaultApp.SetViewOptions(o)
+}
+
+// func DirectShowError() Displays http error response with data provided in ViewData using the default App.
+func DirectShowError(vd ViewData, err error, w http.ResponseWriter) {
+	defaultApp.DirectShowError(vd, err, w)
+}
+
+// MvcHandler handles requests using the default App - see App.MvcHandler.
+func MvcHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, binderKey string, viewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string) {
+	defaultApp.MvcHandler(ctx, w, r, binderKey, viewDataPolishFunc)
+}
+
+// ClearCacheHandler will clear the cached files of the default App.
+func ClearCacheHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	defaultApp.ClearCacheHandler(ctx, w, r)
+}
+
+// InvalidateCacheHandler evicts cache entries of the default App - see App.InvalidateCacheHandler.
+func InvalidateCacheHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	defaultApp.InvalidateCacheHandler(ctx, w, r)
+}
+
+// MetricsHandler serves the metrics of the default App - see App.MetricsHandler.
+func MetricsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	defaultApp.MetricsHandler(ctx, w, r)
+}
+
+// InitHandler inits every request using the default App - see App.InitHandler.
+func InitHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
+	return defaultApp.InitHandler(ctx, next)
+}
+
+// Wraps a function with initialization-stuff of the default App - see App.WrapWithInit.
+func WrapWithInit(fn func(ch chan struct{}, ctx context.Context), w http.ResponseWriter, customTimeout time.Duration) {
+	defaultApp.WrapWithInit(fn, w, customTimeout)
+}
+
+// RecoverHandler - in case of an error, prints an error message of the default App and logs the error
+func RecoverHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
+	return defaultApp.RecoverHandler(ctx, next)
+}
+
+// LoggingHandler logs when a request started & ended in the AccessLogFormat of the default App.
+func LoggingHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
+	return defaultApp.LoggingHandler(ctx, next)
+}
+
+// Precompile parses every view of the default App into the template cache - see App.Precompile.
+func Precompile() error {
+	return defaultApp.Precompile()
+}
+
+// OnConfigChange registers fn for changes of the given field of the default Apps ServerConfig - see App.OnConfigChange.
+func OnConfigChange(field string, fn ConfigChangeFunc) {
+	defaultApp.OnConfigChange(field, fn)
+}
+
+// ReloadConfig swaps the ServerConfig of the default App - see App.ReloadConfig.
+func ReloadConfig(c *ServerConfig) (changed []string, err error) {
+	return defaultApp.ReloadConfig(c)
+}
+
+// ReloadConfigFromFile reloads the ServerConfig of the default App from the given file - see App.ReloadConfigFromFile.
+func ReloadConfigFromFile(path string) (changed []string, err error) {
+	return defaultApp.ReloadConfigFromFile(path)
+}
+
+// WatchConfigSignal reloads the ServerConfig of the default App on signals - see App.WatchConfigSignal.
+func WatchConfigSignal(path string, sigs ...os.Signal) (stop func()) {
+	return defaultApp.WatchConfigSignal(path, sigs...)
+}
+
+// GetReloadConfigHandler returns a handler reloading the ServerConfig of the default App - see App.GetReloadConfigHandler.
+func GetReloadConfigHandler(path string) alice.CtxHandler {
+	return defaultApp.GetReloadConfigHandler(path)
+}
+
+// NewRedisPageStore returns a PageStore using the SessionStore of the default App - see App.NewRedisPageStore.
+func NewRedisPageStore() *RedisPageStore {
+	return defaultApp.NewRedisPageStore()
+}
+
+// InvalidatePages evicts the cached pages of the default App with the given path prefix - see App.InvalidatePages.
+func InvalidatePages(prefix string) (evicted []string) {
+	return defaultApp.InvalidatePages(prefix)
+}
+
+// NewRouter returns a new Router for the default App - see App.NewRouter.
+func NewRouter() *Router {
+	return defaultApp.NewRouter()
+}
+
+// URLFor returns the path of the route bound to the given binder of the default App - see App.URLFor.
+func URLFor(binderKey string, params ...interface{}) (string, error) {
+	return defaultApp.URLFor(binderKey, params...)
+}
+
+// AbsoluteURLFor returns the URL of the route bound to the given binder of the default App - see App.AbsoluteURLFor.
+func AbsoluteURLFor(binderKey string, params ...interface{}) (string, error) {
+	return defaultApp.AbsoluteURLFor(binderKey, params...)
+}
+
+// BindForm decodes & validates the form or JSON body of r into dst using the default App - see App.BindForm.
+func BindForm(ctx context.Context, r *http.Request, dst interface{}) (FieldErrors, error) {
+	return defaultApp.BindForm(ctx, r, dst)
+}
+
+// Validate checks v against the rules of its tags using the default App - see App.Validate.
+func Validate(ctx context.Context, v interface{}) (FieldErrors, error) {
+	return defaultApp.Validate(ctx, v)
+}
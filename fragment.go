@@ -0,0 +1,15 @@
+package webfw
+
+import "net/http"
+
+// FragmentHeader is the request header naming the fragment to render, see requestedFragment.
+const FragmentHeader = "X-Fragment"
+
+// requestedFragment returns the name of the template (e.g. a block like "tripTable") the request asks MvcHandler
+// to render instead of the whole view, taken from the FragmentHeader or the ?fragment= parameter.
+func requestedFragment(r *http.Request) string {
+	if f := r.Header.Get(FragmentHeader); f != "" {
+		return f
+	}
+	return r.URL.Query().Get("fragment")
+}
@@ -8,8 +8,11 @@ import (
 	"html/template"
 	"io"
 	"net/http"
+	"io/fs"
 	"net/url"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +31,16 @@ const hTag = "webfw/handlers.go"
 
 type MVCBinder struct {
 	Ctrl Controller
+	// View & SharedTemplate optionally declare the view (relative to RootDir) & shared template (or Layout)
+	// the Controller renders, so Preflight can check them before serving requests.
+	View           string
+	SharedTemplate string
+	// Formats lists the formats (e.g. "json") the ViewData may be serialized as when the client asks for it,
+	// see Renderer. Serializing includes the whole Model & Data, also the parts the view does not show,
+	// so binders only render their view unless they allow other formats here.
+	Formats []string
+	// Cache enables caching the rendered output, see PageCache.
+	Cache *PageCache
 }
 
 var SessionStoreKey = []byte{152, 193, 128, 220, 47, 161, 2, 237, 144, 57,
@@ -35,14 +48,15 @@ var SessionStoreKey = []byte{152, 193, 128, 220, 47, 161, 2, 237, 144, 57,
 	114, 77, 162, 106, 30, 46, 125, 151, 135, 229, 75, 139, 17, 55, 120, 248, 236, 194, 115, 187, 200,
 	117, 95, 164, 3, 209, 143, 20,
 }
+// SessionStore is the SessionStore of the default App. It is replaced when the RedisAddress changes -
+// use DefaultApp().SessionStore() to read it while requests are served.
 var SessionStore *redistore.RediStore
 var storeInited = false
 var MVCBinders map[string]MVCBinder
+// V is the ViewEngine of the default App. Assigning it does not close the old one (see ViewEngine.Close) -
+// prefer SetConfig or ReloadConfig.
 var V *ViewEngine
-var FileCache = struct {
-	sync.RWMutex
-	m map[string][]byte
-}{m: make(map[string][]byte)}
+var FileCache = FileCacheMap{m: make(map[string][]byte)}
 
 
 var MyErrorController ErrorController
@@ -51,21 +65,6 @@ var defaultTranslater *translate.Translater
 // ErrorViewDataPolishFunc - If Non-MVC-Handlers throw an error (=DirectShowError_NoVD called), this function is used to polish the page
 var ErrorViewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string
 
-// DefaultTranslater returns the default translater (if not set, currently "de-DE")
-func DefaultTranslater() *translate.Translater {
-
-	if defaultTranslater != nil {
-		return defaultTranslater
-	}
-	defaultTranslater = GetTranslater("de-DE")
-	return defaultTranslater
-}
-
-// SetDefaultTranslater sets the default translater.
-func SetDefaultTranslater(t *translate.Translater) {
-	defaultTranslater = t
-}
-
 // init initializes the MVCBinders-map.
 func init() {
 	MVCBinders = make(map[string]MVCBinder)
@@ -74,19 +73,26 @@ func init() {
 /* Handlers as final step in a chain */
 
 // GetMvcHandler returns a an alice.CtxHandler that is able to serve MVC-pages.
-func GetMvcHandler(binderKey string, viewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string) alice.CtxHandler {
+func (a *App) GetMvcHandler(binderKey string, viewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string) alice.CtxHandler {
+	return alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		a.MvcHandler(ctx, w, r, binderKey, viewDataPolishFunc)
+	})
+}
+
+func (a *App) GetProvideFolderContentHandler(folderRelative string, partToRemoveFromUrlPath string) alice.CtxHandler {
 	return alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		MvcHandler(ctx, w, r, binderKey, viewDataPolishFunc)
+		a.ProvideFolderContentHandler(ctx, w, r, folderRelative, partToRemoveFromUrlPath, false, "")
 	})
 }
 
-func GetProvideFolderContentHandler(folderRelative string, partToRemoveFromUrlPath string) alice.CtxHandler {
+// GetProvideFSContentHandler returns an alice.CtxHandler serving the files of the given fs.FS (e.g. an embed.FS).
+func (a *App) GetProvideFSContentHandler(fsys fs.FS, partToRemoveFromUrlPath string) alice.CtxHandler {
 	return alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-		ProvideFolderContentHandler(ctx, w, r, folderRelative, partToRemoveFromUrlPath, false, "")
+		a.ProvideFSContentHandler(ctx, w, r, fsys, partToRemoveFromUrlPath, false)
 	})
 }
 
-func DirectShowError_NoVD(ctx context.Context, w http.ResponseWriter, r *http.Request, err error, errorMessage string, errorType int, notStyled ...bool) {
+func (a *App) DirectShowError_NoVD(ctx context.Context, w http.ResponseWriter, r *http.Request, err error, errorMessage string, errorType int, notStyled ...bool) {
 	var T *translate.Translater
 	if ctx != nil {
 		if ctx.Value("T") != nil {
@@ -94,7 +100,7 @@ func DirectShowError_NoVD(ctx context.Context, w http.ResponseWriter, r *http.Re
 		}
 	}
 	if T == nil {
-		T = DefaultTranslater()
+		T = a.DefaultTranslater()
 	}
 
 	vd := ViewData{
@@ -104,19 +110,44 @@ func DirectShowError_NoVD(ctx context.Context, w http.ResponseWriter, r *http.Re
 		ErrorType:      errorType,
 		NoStyleOnError: len(notStyled) > 0 && notStyled[0],
 	}
-	if ErrorViewDataPolishFunc != nil {
+	if polish := *a.errorPolishFunc; polish != nil {
 		// TODO : Find a better solution than passing the views/odl.html that should be unknown!
-		ErrorViewDataPolishFunc(&vd, ctx, r, "views/odl.html")
+		polish(&vd, ctx, r, "views/odl.html")
 
 	}
-	DirectShowError(vd, err, w)
+	a.DirectShowError(vd, err, w)
 }
 
-func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, folderRelative string, partToRemoveFromUrlPath string, asDownload bool, folderAbsolute string) (err error) {
+// ProvideFolderContentHandler serves the files of folderAbsolute or of folderRelative (relative to RootDir,
+// read from the fs.FS of the App if set - see App.SetFS).
+func (a *App) ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, folderRelative string, partToRemoveFromUrlPath string, asDownload bool, folderAbsolute string) (err error) {
+	var dir http.FileSystem
+	if folderAbsolute != "" {
+		dir = http.Dir(folderAbsolute)
+	} else if fsys := a.customFS(); fsys != nil {
+		sub, err := fs.Sub(fsys, fsName("", folderRelative))
+		if err != nil {
+			a.DirectShowError_NoVD(ctx, w, r, err, http.StatusText(404), 404, true)
+			return err
+		}
+		dir = http.FS(sub)
+	} else {
+		dir = http.Dir(a.Config().RootDir + "/" + folderRelative)
+	}
+	return a.serveFileSystem(ctx, w, r, dir, partToRemoveFromUrlPath, asDownload)
+}
+
+// ProvideFSContentHandler serves the files of the given fs.FS.
+func (a *App) ProvideFSContentHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, fsys fs.FS, partToRemoveFromUrlPath string, asDownload bool) (err error) {
+	return a.serveFileSystem(ctx, w, r, http.FS(fsys), partToRemoveFromUrlPath, asDownload)
+}
+
+// serveFileSystem serves the file of dir requested by r, caching it in the FileCache if the Profile says so.
+func (a *App) serveFileSystem(ctx context.Context, w http.ResponseWriter, r *http.Request, dir http.FileSystem, partToRemoveFromUrlPath string, asDownload bool) (err error) {
 	defer func() {
 		if rec := recover(); rec != nil {
 			//showError(ctx, "File not found", w, r)
-			DirectShowError_NoVD(ctx, w, r, errors.New(fmt.Sprintf("Error in Recover ProvideFolderContentHandler : ", rec)), http.StatusText(404), 404, true)
+			a.DirectShowError_NoVD(ctx, w, r, errors.New(fmt.Sprintf("Error in Recover ProvideFolderContentHandler : %v", rec)), http.StatusText(404), 404, true)
 
 			dbg.I(hTag, "ProvideFolderContentHandler recovered ")
 			err = errors.New("ProvideFolderContentHandler recovered ")
@@ -124,22 +155,18 @@ func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *
 		}
 	}()
 
-	var dir http.Dir
-	if folderAbsolute == "" {
-		dir = http.Dir(Config().RootDir + "/" + folderRelative)
-	} else {
-		dir = http.Dir(folderAbsolute)
-	}
+	c := a.Config()
 	u, err := url.Parse(r.RequestURI)
 	if err != nil {
-		DirectShowError_NoVD(ctx, w, r, err, http.StatusText(404), 404, true)
+		a.DirectShowError_NoVD(ctx, w, r, err, http.StatusText(404), 404, true)
 		return err
 	}
 
-	FileCache.RLock()
-	cached, ok := FileCache.m[u.Path]
-	FileCache.RUnlock()
-	fileCached := bool(!dbg.Develop) && ok
+	a.fileCache.RLock()
+	cached, ok := a.fileCache.m[u.Path]
+	a.fileCache.RUnlock()
+	cacheFiles := a.Profile().CacheFiles
+	fileCached := cacheFiles && ok
 
 	if fileCached {
 		if asDownload {
@@ -150,8 +177,8 @@ func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *
 	}
 
 	p := u.Path
-	if config.SubDir != "" {
-		p = strings.Replace(p, config.SubDir, "", 1)
+	if c.SubDir != "" {
+		p = strings.Replace(p, c.SubDir, "", 1)
 	}
 	path := filepath.Clean(strings.Replace(p, partToRemoveFromUrlPath, "", 1))
 
@@ -165,7 +192,7 @@ func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *
 		for {
 			n, err := f.Read(buf)
 			if err != nil && err != io.EOF {
-				DirectShowError(ViewData{ErrorType: 500, NoStyleOnError: true}, err, w)
+				a.DirectShowError(ViewData{ErrorType: 500, NoStyleOnError: true}, err, w)
 				dbg.W(hTag, "ProvideFolderContentHandler - error reading file ", err)
 
 				return err
@@ -180,9 +207,11 @@ func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *
 		if err == nil || err == io.EOF {
 			bWriter.Flush()
 			by := b.Bytes()
-			FileCache.Lock()
-			FileCache.m[u.Path] = by
-			FileCache.Unlock()
+			if cacheFiles {
+				a.fileCache.Lock()
+				a.fileCache.m[u.Path] = by
+				a.fileCache.Unlock()
+			}
 			if asDownload {
 				w.Header().Set("Content-Disposition", "attachment")
 			}
@@ -191,7 +220,7 @@ func ProvideFolderContentHandler(ctx context.Context, w http.ResponseWriter, r *
 
 		}
 	}
-	DirectShowError_NoVD(ctx, w, r, nil, http.StatusText(404), 404, true)
+	a.DirectShowError_NoVD(ctx, w, r, nil, http.StatusText(404), 404, true)
 	dbg.W(hTag, " File failed to read : ", path, "-", err)
 	if err == nil {
 		err = errors.New("Unknown failure while reading file")
@@ -237,7 +266,7 @@ func appendMessage(origmsg string, newmsg string, ignoreIfOther bool) string {
 }
 
 // func DirectShowError() Displays http error response with data provided in ViewData.**
-func DirectShowError(vd ViewData, err error, w http.ResponseWriter) {
+func (a *App) DirectShowError(vd ViewData, err error, w http.ResponseWriter) {
 
 	if err != nil && vd.ErrorType == 0 {
 		vd.ErrorType = 500
@@ -254,43 +283,91 @@ func DirectShowError(vd ViewData, err error, w http.ResponseWriter) {
 	dbg.I(hTag, "Error page shown: \t Source : %v \r\n\t Type : %v \r\n\t DebugMessage : %v \r\n\t ClientMessage : %v \r\n\t Error : %v",
 		vd.ErrorSource, vd.ErrorType, vd.ErrorMessage, err)
 
-	if MyErrorController == nil || vd.NoStyleOnError {
-		http.Error(w, fmt.Sprintf("%v", vd.ErrorMessage), vd.ErrorType)
+	if err != nil && a.Profile().ErrorDetail == ErrorDetailFull {
+		vd.ErrorDetail = fmt.Sprintf("%s : %v", vd.ErrorSource, err)
+	}
+
+	ec := a.ErrorController()
+	if ec == nil || vd.NoStyleOnError {
+		msg := fmt.Sprintf("%v", vd.ErrorMessage)
+		if vd.ErrorDetail != "" {
+			msg += "\n\n" + vd.ErrorDetail
+		}
+		http.Error(w, msg, vd.ErrorType)
 	} else {
-		var b bytes.Buffer
-		vd, vPath, vSharedTemplate, err := MyErrorController.GetViewData(vd, err)
+		b := getBuffer()
+		defer putBuffer(b)
+		vd, vPath, vSharedTemplate, err := ec.GetViewData(vd, err)
 		if err != nil {
 			dbg.E(hTag, "Error getting ErrorController ViewData : ", err)
 			http.Error(w, fmt.Sprintf("%v", vd.ErrorMessage), vd.ErrorType)
 			return
 		}
-		tpl, err := V.GetTemplate(vPath, Config().RootDir+"/"+vPath, vSharedTemplate)
+		v := a.Views()
+		tpl, err := v.GetViewTemplate(vPath, a.Config().RootDir+"/"+vPath, vSharedTemplate)
 		if err != nil {
 			dbg.E(hTag, "Error getting template for ErrorController ViewData : ", err)
 			http.Error(w, fmt.Sprintf("%v", vd.ErrorMessage), vd.ErrorType)
+			return
 		}
-		err = V.RenderWriter(vd, tpl, &b, vd.ViewName)
+		err = v.RenderViewWriter(vd, tpl, b, vd.ViewName)
 		if err != nil {
 			dbg.E(hTag, "Error rendering ErrorController ViewData : ", err)
 			http.Error(w, fmt.Sprintf("%v", vd.ErrorMessage), vd.ErrorType)
 			return
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(vd.ErrorType)
-		// It might be redundant to first write it to a buffer and then to the response writer, but...
-		// I might say it's more secure for errors,... Or I just thought it differently and now it's implemented this way ;)
-		fmt.Fprintln(w, b.String())
+		writeBuffered(w, vd.ErrorType, b)
 	}
 }
 
 // MvcHandler is the entry point for handling requests - bind this (as last part of a chain) e.g. to http.Handle("/*")
-func MvcHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, binderKey string, viewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string) {
+func (a *App) MvcHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, binderKey string, viewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string) {
 	dbg.D(hTag, "Start MvcHandler")
+	start := time.Now()
+	sw := requestStatusWriter(ctx, w)
+	w = sw
+	a.setSecurityHeaders(w)
+	defer func() {
+		a.metrics.requestDuration.observe(time.Since(start), binderKey, strconv.Itoa(sw.Status()))
+	}()
 
-	binder, foundTpl := MVCBinders[binderKey]
+	binder, foundTpl := a.Binder(binderKey)
 
 	if foundTpl {
+		format := FormatHTML
+		if len(binder.Formats) != 0 {
+			w.Header().Add("Vary", "Accept")
+			var ok bool
+			if format, ok = negotiateFormat(r, binder.Formats); !ok {
+				http.Error(w, fmt.Sprintf("Unknown format %q", format), http.StatusNotAcceptable)
+				return
+			}
+		}
+		if pc := binder.Cache; pc != nil && pc.cacheable(ctx, r) {
+			store, key := a.pageStoreFor(pc), pc.key(ctx, r, format)
+			if p, ok := store.Get(key); ok {
+				a.metrics.pageCacheHits.inc(binderKey)
+				p.write(w, r)
+				return
+			}
+			a.metrics.pageCacheMisses.inc(binderKey)
+			w.Header().Set(PageCacheHeader, "MISS")
+			rec := &pageRecorder{ResponseWriter: w}
+			w = rec
+			defer func() {
+				if p, ok := rec.page(); ok {
+					if err := store.Set(key, p, pc.TTL); err != nil {
+						dbg.W(hTag, "Error caching page %s : %v", r.URL.Path, err)
+					}
+				}
+			}()
+		}
 		vd, vPath, vShared, err := binder.Ctrl.GetViewData(ctx, r)
+		if rec, ok := w.(*pageRecorder); ok && vd.Stream {
+			// An error after the first Flush can not be shown anymore - do not cache a possibly broken page.
+			rec.skip = true
+		}
 
 		if vd.ViewName == "" {
 			vd.ViewName = binderKey
@@ -298,21 +375,56 @@ func MvcHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, bin
 		if viewDataPolishFunc != nil {
 			vPath = viewDataPolishFunc(&vd, ctx, r, vPath)
 		}
+		if format != FormatHTML {
+			if vd.ErrorType != 0 || err != nil {
+				a.serializedError(w, format, vd, err)
+			} else {
+				a.writeSerialized(w, format, vd, http.StatusOK)
+			}
+			return
+		}
 		if vd.ErrorType != 0 || err != nil {
 			// An error was returned - display http error code
-			DirectShowError(vd, err, w)
+			a.DirectShowError(vd, err, w)
 			return
 		}
-		tpl, err := V.GetTemplate(vPath, Config().RootDir+"/"+vPath, vShared)
+		if vd.Redirect != "" {
+			// No view is needed to redirect, e.g. after a form was posted.
+			http.Redirect(w, r, vd.Redirect, vd.redirectStatus())
+			return
+		}
+		v := a.Views()
+		tpl, err := v.GetViewTemplate(vPath, a.Config().RootDir+"/"+vPath, vShared)
 		foundTpl = err == nil
 		if foundTpl {
+			// AJAX requests may ask for a single block of the view, see FragmentHeader.
+			w.Header().Add("Vary", FragmentHeader)
+			if ct := viewContentType(vPath); ct != "" && w.Header().Get("Content-Type") == "" {
+				w.Header().Set("Content-Type", ct)
+			}
+			fragment := requestedFragment(r)
+			if fragment != "" {
+				if !templateEngineFor(vPath).HasTemplate(tpl, fragment) {
+					dbg.I(hTag, "Unknown fragment %q requested for %s", fragment, vPath)
+					http.Error(w, fmt.Sprintf("Unknown fragment %q", fragment), http.StatusBadRequest)
+					return
+				}
+				vd.NoStyleOnError = true
+			}
 			dbg.V(hTag, "Start render")
-			V.RenderHttpResp(vd, tpl, w, r, "")
+			v.renderHttpResp(vd, tpl, w, r, fragment, a.DirectShowError)
 			dbg.V(hTag, "End render")
 		} else {
-			if strings.Contains(err.Error(), "no such file") {
+			if os.IsNotExist(err) {
 				dbg.I("Template not found : ", vPath, err)
-				DirectShowError_NoVD(ctx, w, r, err, http.StatusText(404), 404)
+				a.DirectShowError_NoVD(ctx, w, r, err, http.StatusText(404), 404)
+				return
+			}
+			if te, ok := err.(*TemplateError); ok && a.Profile().ErrorDetail == ErrorDetailFull {
+				dbg.E(hTag, "Error parsing template %s : %v", vPath, err)
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(500)
+				writeTemplateErrorPage(w, TemplateErrors{te})
 				return
 			}
 			dbg.E(hTag, "Error loading template %s : %v", vPath, err)
@@ -320,22 +432,12 @@ func MvcHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, bin
 	}
 	if !foundTpl {
 		dbg.E(hTag, "No view found for "+binderKey)
-		DirectShowError_NoVD(ctx, w, r, nil, http.StatusText(500), 500)
+		a.DirectShowError_NoVD(ctx, w, r, nil, http.StatusText(500), 500)
 
 	}
 	dbg.D(hTag, "End MvcHandler")
 }
 
-// ClearCacheHandler will clear the cached files.
-func ClearCacheHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	dbg.D(hTag, "Clearing cache")
-	V.ClearCache()
-	FileCache.Lock()
-	FileCache.m = make(map[string][]byte)
-	FileCache.Unlock()
-
-}
-
 /* Handlers for before final handlers */
 
 // GorillaClearHandler clears a Gorilla-context.
@@ -350,17 +452,21 @@ func GorillaClearHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHa
 	return alice.CtxHandlerFunc(fn)
 }
 
-// LoggingHandler logs when a request started & ended, including the requests URL
-func LoggingHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
+// LoggingHandler logs when a request started & ended, in the AccessLogFormat of the Apps Profile.
+func (a *App) LoggingHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
 	fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 
 		t1 := time.Now()
-		next.ServeHTTP(ctx, w, r)
+		sw := newStatusWriter(w)
+		next.ServeHTTP(ctx, sw, r)
 		t2 := time.Now()
-		if dbg.Develop {
+		switch a.Profile().AccessLogFormat {
+		case AccessLogURL:
 			dbg.I(hTag, "[%s] %q %v\n", r.Method, r.URL.String(), t2.Sub(t1))
-
-		} else {
+		case AccessLogCombined:
+			dbg.I(hTag, "%s - - [%s] \"%s %s %s\" %d %d %q %q %v\n", r.RemoteAddr, t1.Format("02/Jan/2006:15:04:05 -0700"),
+				r.Method, r.URL.Path, r.Proto, sw.Status(), sw.Size(), r.Referer(), r.UserAgent(), t2.Sub(t1))
+		default:
 			dbg.I(hTag, "[%s] %q %v\n", r.Method, r.URL.Path, t2.Sub(t1))
 		}
 	}
@@ -369,20 +475,59 @@ func LoggingHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler
 }
 
 var redisInited bool
+var redisMutex = &sync.Mutex{}
+
+// SessionStoreCloseDelay is the time requests still using the old SessionStore get to finish
+// after the RedisAddress changed, before it is closed.
+var SessionStoreCloseDelay = time.Minute
+
+// resetSessionStore replaces the current SessionStore by a new one using the new RedisAddress.
+// The old one is closed after SessionStoreCloseDelay, as requests in flight may still use it.
+func (a *App) resetSessionStore(old *ServerConfig, new *ServerConfig) {
+	a.redisMutex.Lock()
+	inited := *a.redisInited
+	a.redisMutex.Unlock()
+	if !inited {
+		// The first request creates the SessionStore using the new RedisAddress.
+		return
+	}
+	dbg.I(hTag, "RedisAddress changed from %s to %s - reconnecting SessionStore", old.RedisAddress, new.RedisAddress)
+	store, err := redistore.NewRediStore(10, "tcp", new.RedisAddress, "", SessionStoreKey)
+
+	a.redisMutex.Lock()
+	oldStore := *a.sessionStore
+	if err != nil {
+		// Let the next request try again.
+		dbg.E(hTag, "Error while initialising redistore for %s : %v", new.RedisAddress, err)
+		*a.redisInited = false
+	} else {
+		*a.sessionStore = store
+	}
+	a.redisMutex.Unlock()
+
+	if oldStore != nil {
+		time.AfterFunc(SessionStoreCloseDelay, func() {
+			if err := oldStore.Close(); err != nil {
+				dbg.W(hTag, "Error closing old SessionStore : %v", err)
+			}
+		})
+	}
+}
 
 // InitHandler inits every request by initializing a context
 // and starting the process in a new goroutine - if it does not finish before Config.MaxResponseTime,
 // we will print Config.TimeoutMessage and return.
-func InitHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
+func (a *App) InitHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
 	fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				a.metrics.panics.inc("InitHandler")
 				dbg.E(hTag, "panic in InitHandler: %v for request : %v", err, dbg.GetRequest(r))
-				DirectShowError(ViewData{ErrorType: 500}, errors.New(fmt.Sprintf("%s", err)), w)
+				a.DirectShowError(ViewData{ErrorType: 500}, errors.New(fmt.Sprintf("%s", err)), w)
 
 			}
 		}()
-		if dbg.Develop {
+		if a.Profile().AccessLogFormat == AccessLogURL {
 			dbg.D(hTag, "My url : %s ", r.RequestURI)
 		} else {
 			dbg.D(hTag, "My url : %s ", r.URL.Path)
@@ -393,7 +538,7 @@ func InitHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
 
 		}
 
-		WrapWithInit(serveFn, w, 0)
+		a.WrapWithInit(serveFn, w, 0)
 	}
 
 	return alice.CtxHandlerFunc(fn)
@@ -403,23 +548,30 @@ func InitHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
 // new httprouter used in goodl.go (to get rid of the Inithandler, you know?)
 
 // Wraps a function with initialization-stuff (redis init, context-init, timeout-wrapping)
-func WrapWithInit(fn func(ch chan struct{}, ctx context.Context), w http.ResponseWriter, customTimeout time.Duration) {
-	if !redisInited {
+func (a *App) WrapWithInit(fn func(ch chan struct{}, ctx context.Context), w http.ResponseWriter, customTimeout time.Duration) {
+	a.redisMutex.Lock()
+	if !*a.redisInited {
 		var err error
-		SessionStore, err = redistore.NewRediStore(10, "tcp", config.RedisAddress, "", SessionStoreKey)
+		*a.sessionStore, err = redistore.NewRediStore(10, "tcp", a.Config().RedisAddress, "", SessionStoreKey)
 
 		if err != nil {
+			a.redisMutex.Unlock()
 			dbg.E(hTag, "Error while initialising redistore : ")
 			panic(err)
 		}
-		redisInited = true
+		*a.redisInited = true
 	}
-	ctx, ctxCancel := context.WithCancel(context.Background())
+	a.redisMutex.Unlock()
+
+	c := a.Config()
+	a.setSecurityHeaders(w)
+	sw := newStatusWriter(w)
+	ctx, ctxCancel := context.WithCancel(context.WithValue(context.Background(), statusWriterKey{}, sw))
 
 	serveChan := make(chan struct{})
 	go fn(serveChan, ctx)
 
-	timeout := Config().MaxResponseTime
+	timeout := c.MaxResponseTime
 	if customTimeout > 0 {
 		timeout = customTimeout
 	}
@@ -434,7 +586,8 @@ func WrapWithInit(fn func(ch chan struct{}, ctx context.Context), w http.Respons
 		case <-time.After(timeout):
 			{ // timed out. present error.
 				ctxCancel()
-				fmt.Fprintln(w, Config().TimeoutMessage)
+				a.metrics.timeouts.inc()
+				fmt.Fprintln(sw, c.TimeoutMessage)
 				return
 			}
 		}
@@ -442,12 +595,13 @@ func WrapWithInit(fn func(ch chan struct{}, ctx context.Context), w http.Respons
 }
 
 // RecoverHandler - in case of an error, prints an error message and logs the error
-func RecoverHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
+func (a *App) RecoverHandler(ctx context.Context, next alice.CtxHandler) alice.CtxHandler {
 	fn := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				a.metrics.panics.inc("RecoverHandler")
 				dbg.E(hTag, "panic in RecoverHandler: %v for request : %v", err, dbg.GetRequest(r))
-				DirectShowError(ViewData{ErrorType: 500}, errors.New(fmt.Sprintf("%s", err)), w)
+				a.DirectShowError(ViewData{ErrorType: 500}, errors.New(fmt.Sprintf("%s", err)), w)
 
 			}
 		}()
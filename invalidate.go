@@ -0,0 +1,205 @@
+package webfw
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Compufreak345/dbg"
+	"golang.org/x/net/context"
+)
+
+// Scopes accepted by InvalidateCacheHandler.
+const (
+	// InvalidateAll clears all caches, like ClearCacheHandler.
+	InvalidateAll = "all"
+	// InvalidateTemplateScope evicts a view key, see ViewEngine.InvalidateTemplate.
+	InvalidateTemplateScope = "template"
+	// InvalidateSharedScope reloads a shared template, see ViewEngine.InvalidateShared.
+	InvalidateSharedScope = "shared"
+	// InvalidateFileScope evicts everything parsed from a template file, see ViewEngine.InvalidateFile.
+	InvalidateFileScope = "file"
+	// InvalidatePrefixScope evicts the views with a key prefix, see ViewEngine.InvalidatePrefix.
+	InvalidatePrefixScope = "prefix"
+	// InvalidateStaticScope evicts a file of the FileCache, see FileCacheMap.Invalidate.
+	InvalidateStaticScope = "static"
+	// InvalidateStaticPrefixScope evicts the files of the FileCache with an URL path prefix, see FileCacheMap.InvalidatePrefix.
+	InvalidateStaticPrefixScope = "static-prefix"
+	// InvalidatePageScope evicts the cached pages with an URL path prefix, see App.InvalidatePages.
+	InvalidatePageScope = "page"
+)
+
+// ClearCache evicts all cached templates, parses the shared templates again and rebuilds the AssetManifest.
+func (v *ViewEngine) ClearCache() {
+	v.assets.Rebuild()
+	shared, errs := v.loadSharedTemplates(v.sharedDir)
+	for _, err := range errs {
+		dbg.E(vTag, "Error parsing shared template : %v", err)
+	}
+	v.sharedMutex.Lock()
+	v.SharedTemplates = shared
+	v.sharedErrByName = v.sharedErrorsByName(errs)
+	v.sharedMutex.Unlock()
+
+	v.tempCacheMutex.Lock()
+	v.templateCache = make(map[string]Template)
+	v.deps = make(map[string]map[string]bool)
+	v.cacheGen++
+	v.tempCacheMutex.Unlock()
+}
+
+// InvalidateTemplate evicts the view with the given key (as passed to GetViewTemplate, e.g. "views/odl.html")
+// for all shared templates it was cached with. It returns the evicted cache keys.
+func (v *ViewEngine) InvalidateTemplate(key string) (evicted []string) {
+	return v.evictKeys(func(k string) bool {
+		return strings.HasPrefix(k, templateCacheKey(key, ""))
+	})
+}
+
+// InvalidatePrefix evicts all views whose key starts with prefix, e.g. "views/trips/".
+// It returns the evicted cache keys.
+func (v *ViewEngine) InvalidatePrefix(prefix string) (evicted []string) {
+	return v.evictKeys(func(k string) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+}
+
+// InvalidateShared parses the shared template with the given name (e.g. "odl.html") again and evicts every view
+// cached with it. It returns the evicted cache keys.
+func (v *ViewEngine) InvalidateShared(name string) (evicted []string) {
+	return v.InvalidateFile(v.sharedDir + name)
+}
+
+// InvalidateFile evicts every template parsed from the view, shared template or sidecar file at the given path
+// (absolute or relative to RootDir). Shared templates are parsed again.
+// It returns the evicted cache keys.
+func (v *ViewEngine) InvalidateFile(path string) (evicted []string) {
+	// A changed sidecar file changes its template.
+	name := strings.TrimSuffix(fsName(v.rootDir, path), ViewSidecarSuffix)
+	if sharedPrefix := fsName(v.rootDir, v.sharedDir) + "/"; strings.HasPrefix(name, sharedPrefix) {
+		v.reloadShared(strings.TrimPrefix(name, sharedPrefix))
+	}
+
+	v.tempCacheMutex.Lock()
+	for key := range v.deps[name] {
+		if _, ok := v.templateCache[key]; ok {
+			delete(v.templateCache, key)
+			evicted = append(evicted, key)
+		}
+	}
+	delete(v.deps, name)
+	v.cacheGen++
+	v.tempCacheMutex.Unlock()
+	sort.Strings(evicted)
+	return
+}
+
+// evictKeys evicts all cached templates whose cache key matches.
+func (v *ViewEngine) evictKeys(match func(key string) bool) (evicted []string) {
+	v.tempCacheMutex.Lock()
+	for key := range v.templateCache {
+		if match(key) {
+			delete(v.templateCache, key)
+			evicted = append(evicted, key)
+		}
+	}
+	v.cacheGen++
+	v.tempCacheMutex.Unlock()
+	sort.Strings(evicted)
+	return
+}
+
+// Invalidate evicts the file cached for the given URL path and reports whether it was cached.
+func (c *FileCacheMap) Invalidate(urlPath string) bool {
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.m[urlPath]
+	delete(c.m, urlPath)
+	return ok
+}
+
+// InvalidatePrefix evicts all files cached for URL paths starting with prefix and returns their paths.
+func (c *FileCacheMap) InvalidatePrefix(prefix string) (evicted []string) {
+	c.Lock()
+	for p := range c.m {
+		if strings.HasPrefix(p, prefix) {
+			delete(c.m, p)
+			evicted = append(evicted, p)
+		}
+	}
+	c.Unlock()
+	sort.Strings(evicted)
+	return
+}
+
+// Clear evicts all cached files and returns their number.
+func (c *FileCacheMap) Clear() (n int) {
+	c.Lock()
+	n = len(c.m)
+	c.m = make(map[string][]byte)
+	c.Unlock()
+	return
+}
+
+// ClearCacheHandler will clear the cached templates, files & pages.
+func (a *App) ClearCacheHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	dbg.D(hTag, "Clearing cache")
+	a.Views().ClearCache()
+	a.fileCache.Clear()
+	a.InvalidatePages("")
+}
+
+// InvalidateCacheHandler evicts cache entries selected by the form values scope (see InvalidateAll...) & key
+// and answers with the evicted entries. Protect it like any other admin handler.
+//
+//	POST /admin/cache?scope=prefix&key=views/trips/
+func (a *App) InvalidateCacheHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(405), 405)
+		return
+	}
+	scope, key := r.FormValue("scope"), r.FormValue("key")
+	if key == "" && scope != InvalidateAll {
+		http.Error(w, fmt.Sprintf("key is required for scope %q", scope), 400)
+		return
+	}
+
+	v := a.Views()
+	var evicted []string
+	switch scope {
+	case InvalidateAll:
+		evicted = append(v.InvalidatePrefix(""), a.fileCache.InvalidatePrefix("")...)
+		evicted = append(evicted, a.InvalidatePages("")...)
+		v.ClearCache()
+	case InvalidateTemplateScope:
+		evicted = v.InvalidateTemplate(key)
+	case InvalidateSharedScope:
+		evicted = v.InvalidateShared(key)
+	case InvalidateFileScope:
+		evicted = v.InvalidateFile(key)
+	case InvalidatePrefixScope:
+		evicted = v.InvalidatePrefix(key)
+	case InvalidateStaticScope:
+		if a.fileCache.Invalidate(key) {
+			evicted = []string{key}
+		}
+	case InvalidateStaticPrefixScope:
+		evicted = a.fileCache.InvalidatePrefix(key)
+	case InvalidatePageScope:
+		evicted = a.InvalidatePages(key)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown scope %q, known are %s", scope, strings.Join([]string{InvalidateAll,
+			InvalidateTemplateScope, InvalidateSharedScope, InvalidateFileScope, InvalidatePrefixScope,
+			InvalidateStaticScope, InvalidateStaticPrefixScope, InvalidatePageScope}, ", ")), 400)
+		return
+	}
+	dbg.I(hTag, "Cache invalidated, scope %s, key %q : %d entries evicted", scope, key, len(evicted))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%d entries evicted\n", len(evicted))
+	for _, e := range evicted {
+		fmt.Fprintln(w, e)
+	}
+}
@@ -0,0 +1,490 @@
+package webfw
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Compufreak345/dbg"
+)
+
+const mTag = dbg.Tag("webfw/mailer.go")
+
+// ErrMailerStopped is returned by Mailer.Enqueue after Stop was called.
+var ErrMailerStopped = errors.New("Mailer stopped")
+
+// Mail is a mail rendered from views by a Mailer.
+type Mail struct {
+	// From defaults to ServerConfig.SmtpFrom.
+	From    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	ReplyTo string
+	// Subject is translated using Data.T if set.
+	Subject string
+	// HTMLView & TextView (relative to RootDir) are rendered with Data using the given shared templates (see Layout).
+	// At least one of them is required - use a view parsed by TextTemplateEngine (e.g. ".txt") as TextView.
+	HTMLView   string
+	HTMLLayout string
+	TextView   string
+	TextLayout string
+	Data       ViewData
+	// Attachments are added to the mail as files.
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Mail.
+type Attachment struct {
+	Name string
+	// ContentType defaults to the type of the extension of Name.
+	ContentType string
+	Data        []byte
+}
+
+// Mailer renders Mails using the ViewEngine of an App and sends them using the SMTP settings of its ServerConfig.
+// Mails are sent directly by Send or in the background with retries by Enqueue.
+type Mailer struct {
+	app *App
+	// MaxAttempts is the number of times Enqueue tries to send a mail.
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, doubled for each further retry.
+	RetryDelay time.Duration
+	// Timeout limits connecting to the SMTP server.
+	Timeout time.Duration
+	// TLSConfig is used for STARTTLS - if nil, the SmtpHost is verified.
+	TLSConfig *tls.Config
+	// OnFailure is called for every enqueued mail that could not be sent.
+	OnFailure func(msg *MailMessage, err error)
+
+	queue    chan *MailMessage
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	// mutex orders Enqueue & Stop, enqueuing counts the Enqueue calls sending to the queue.
+	mutex     sync.Mutex
+	enqueuing sync.WaitGroup
+}
+
+// MailMessage is a rendered Mail ready to be sent.
+type MailMessage struct {
+	From       string
+	Recipients []string
+	Data       []byte
+	attempts   int
+}
+
+// NewMailer returns a Mailer for the App, sending enqueued mails using the given number of workers.
+func (a *App) NewMailer(workers int) *Mailer {
+	if workers < 1 {
+		workers = 1
+	}
+	m := &Mailer{
+		app:         a,
+		MaxAttempts: 5,
+		RetryDelay:  30 * time.Second,
+		Timeout:     30 * time.Second,
+		queue:       make(chan *MailMessage, 100),
+		done:        make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Send renders & sends the given Mail.
+func (m *Mailer) Send(ml *Mail) error {
+	msg, err := m.Render(ml)
+	if err != nil {
+		return err
+	}
+	return m.SendMessage(msg)
+}
+
+// Enqueue renders the given Mail and sends it in the background, retrying MaxAttempts times with growing delays.
+// Rendering errors are returned directly.
+func (m *Mailer) Enqueue(ml *Mail) error {
+	msg, err := m.Render(ml)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	if m.isStopped() {
+		m.mutex.Unlock()
+		return ErrMailerStopped
+	}
+	m.enqueuing.Add(1)
+	m.mutex.Unlock()
+	defer m.enqueuing.Done()
+	// The queue may be full while the SMTP server is down - do not block Stop.
+	select {
+	case m.queue <- msg:
+		return nil
+	case <-m.done:
+		return ErrMailerStopped
+	}
+}
+
+// Stop waits until all enqueued mails were sent or failed. Mails waiting for a retry are given up.
+func (m *Mailer) Stop() {
+	m.stopOnce.Do(func() {
+		m.mutex.Lock()
+		close(m.done)
+		m.mutex.Unlock()
+		// No Enqueue may send to the queue once it is closed.
+		m.enqueuing.Wait()
+		close(m.queue)
+	})
+	m.wg.Wait()
+}
+
+// isStopped returns whether Stop was called.
+func (m *Mailer) isStopped() bool {
+	select {
+	case <-m.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// work sends the enqueued mails.
+func (m *Mailer) work() {
+	defer m.wg.Done()
+	for msg := range m.queue {
+		m.sendWithRetries(msg)
+	}
+}
+
+// sendWithRetries sends msg, retrying temporary failures until MaxAttempts is reached or the Mailer is stopped.
+func (m *Mailer) sendWithRetries(msg *MailMessage) {
+	delay := m.RetryDelay
+	for {
+		msg.attempts++
+		err := m.SendMessage(msg)
+		if err == nil {
+			return
+		}
+		if msg.attempts >= m.MaxAttempts || isPermanentSmtpError(err) || m.isStopped() {
+			dbg.E(mTag, "Giving up sending mail to %v after %d attempts : %v", msg.Recipients, msg.attempts, err)
+			if m.OnFailure != nil {
+				m.OnFailure(msg, err)
+			}
+			return
+		}
+		dbg.W(mTag, "Error sending mail to %v (attempt %d), retrying in %v : %v", msg.Recipients, msg.attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-m.done:
+		}
+		delay *= 2
+	}
+}
+
+// isPermanentSmtpError reports whether the SMTP server rejected the mail permanently (5xx).
+func isPermanentSmtpError(err error) bool {
+	var tpErr *textproto.Error
+	return errors.As(err, &tpErr) && tpErr.Code >= 500
+}
+
+// SendMessage sends the rendered message using the SMTP settings of the ServerConfig.
+// STARTTLS is used if the server supports it, authentication if SmtpUser is set.
+func (m *Mailer) SendMessage(msg *MailMessage) (err error) {
+	c := m.app.Config()
+	addr := net.JoinHostPort(c.SmtpHost, c.SmtpPort)
+	conn, err := net.DialTimeout("tcp", addr, m.Timeout)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.SmtpHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := m.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: c.SmtpHost}
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if c.SmtpUser != "" {
+		if err = client.Auth(smtp.PlainAuth("", c.SmtpUser, c.SmtpPassword, c.SmtpHost)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(msg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range msg.Recipients {
+		if err = client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg.Data); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Render renders the views of the given Mail into a MIME message.
+func (m *Mailer) Render(ml *Mail) (*MailMessage, error) {
+	if ml.HTMLView == "" && ml.TextView == "" {
+		return nil, errors.New("Mail : HTMLView or TextView is required")
+	}
+	c := m.app.Config()
+	from := ml.From
+	if from == "" {
+		from = c.SmtpFrom
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("Mail From %q : %v", from, err)
+	}
+	msg := &MailMessage{From: fromAddr.Address}
+	var lists [3][]string
+	for i, list := range [][]string{ml.To, ml.Cc, ml.Bcc} {
+		for _, to := range list {
+			addr, err := mail.ParseAddress(to)
+			if err != nil {
+				return nil, fmt.Errorf("Mail recipient %q : %v", to, err)
+			}
+			msg.Recipients = append(msg.Recipients, addr.Address)
+			lists[i] = append(lists[i], addr.String())
+		}
+	}
+	if len(msg.Recipients) == 0 {
+		return nil, errors.New("Mail : no recipients")
+	}
+
+	var htmlBody, textBody []byte
+	if ml.HTMLView != "" {
+		if htmlBody, err = m.renderView(ml.HTMLView, ml.HTMLLayout, ml.Data); err != nil {
+			return nil, err
+		}
+	}
+	if ml.TextView != "" {
+		if textBody, err = m.renderView(ml.TextView, ml.TextLayout, ml.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	subject := ml.Subject
+	if ml.Data.T != nil {
+		subject = ml.Data.T.T(subject)
+	}
+	var b bytes.Buffer
+	h := textproto.MIMEHeader{}
+	h.Set("From", fromAddr.String())
+	if len(lists[0]) != 0 {
+		h.Set("To", strings.Join(lists[0], ", "))
+	}
+	if len(lists[1]) != 0 {
+		h.Set("Cc", strings.Join(lists[1], ", "))
+	}
+	if ml.ReplyTo != "" {
+		addr, err := mail.ParseAddress(ml.ReplyTo)
+		if err != nil {
+			return nil, fmt.Errorf("Mail ReplyTo %q : %v", ml.ReplyTo, err)
+		}
+		h.Set("Reply-To", addr.String())
+	}
+	h.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	h.Set("Date", time.Now().Format(time.RFC1123Z))
+	h.Set("Message-ID", messageID(fromAddr.Address))
+	h.Set("MIME-Version", "1.0")
+
+	if len(ml.Attachments) == 0 {
+		err = writeMailBody(&b, h, htmlBody, textBody)
+	} else {
+		mw := multipart.NewWriter(&b)
+		h.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		writeMailHeader(&b, h)
+		if err = writeMailBodyPart(mw, htmlBody, textBody); err == nil {
+			for _, a := range ml.Attachments {
+				if err = writeAttachment(mw, a); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg.Data = b.Bytes()
+	return msg, nil
+}
+
+// renderView renders the view at the given path (relative to RootDir) with the given shared templates.
+func (m *Mailer) renderView(view string, layout string, vd ViewData) ([]byte, error) {
+	v := m.app.Views()
+	t, err := v.GetViewTemplate(view, m.app.Config().RootDir+"/"+view, layout)
+	if err != nil {
+		return nil, err
+	}
+	b := getBuffer()
+	defer putBuffer(b)
+	if err = v.RenderViewWriter(vd, t, b, ""); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b.Bytes()...), nil
+}
+
+// writeMailHeader writes the given header followed by an empty line.
+func writeMailHeader(w io.Writer, h textproto.MIMEHeader) {
+	for _, k := range []string{"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID", "MIME-Version",
+		"Content-Type", "Content-Transfer-Encoding"} {
+		if v := h.Get(k); v != "" {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+	io.WriteString(w, "\r\n")
+}
+
+// writeMailBody writes the top-level header & the body of a mail without attachments.
+func writeMailBody(w io.Writer, h textproto.MIMEHeader, htmlBody []byte, textBody []byte) error {
+	if htmlBody != nil && textBody != nil {
+		mw := multipart.NewWriter(w)
+		h.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+		writeMailHeader(w, h)
+		if err := writeAlternatives(mw, htmlBody, textBody); err != nil {
+			return err
+		}
+		return mw.Close()
+	}
+	contentType, body := "text/html; charset=utf-8", htmlBody
+	if htmlBody == nil {
+		contentType, body = "text/plain; charset=utf-8", textBody
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	writeMailHeader(w, h)
+	return writeQuotedPrintable(w, body)
+}
+
+// writeMailBodyPart writes the body as part of a multipart/mixed mail.
+func writeMailBodyPart(mw *multipart.Writer, htmlBody []byte, textBody []byte) error {
+	if htmlBody != nil && textBody != nil {
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + boundary}})
+		if err != nil {
+			return err
+		}
+		alt := multipart.NewWriter(pw)
+		if err = alt.SetBoundary(boundary); err != nil {
+			return err
+		}
+		if err = writeAlternatives(alt, htmlBody, textBody); err != nil {
+			return err
+		}
+		return alt.Close()
+	}
+	contentType, body := "text/html; charset=utf-8", htmlBody
+	if htmlBody == nil {
+		contentType, body = "text/plain; charset=utf-8", textBody
+	}
+	return writeQuotedPrintablePart(mw, contentType, body)
+}
+
+// writeAlternatives writes the text & the HTML body as parts of a multipart/alternative mail.
+func writeAlternatives(mw *multipart.Writer, htmlBody []byte, textBody []byte) error {
+	if err := writeQuotedPrintablePart(mw, "text/plain; charset=utf-8", textBody); err != nil {
+		return err
+	}
+	return writeQuotedPrintablePart(mw, "text/html; charset=utf-8", htmlBody)
+}
+
+// writeQuotedPrintablePart writes body as quoted-printable part with the given Content-Type.
+func writeQuotedPrintablePart(mw *multipart.Writer, contentType string, body []byte) error {
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	return writeQuotedPrintable(pw, body)
+}
+
+// writeQuotedPrintable writes body quoted-printable encoded.
+func writeQuotedPrintable(w io.Writer, body []byte) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write(body); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// writeAttachment writes the given Attachment base64 encoded in lines of 76 characters.
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(filepath.Ext(a.Name)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("Attachment %s : %v", a.Name, err)
+	}
+	params["name"] = a.Name
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(mediaType, params)},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 76 {
+		if _, err = io.WriteString(pw, enc[:76]+"\r\n"); err != nil {
+			return err
+		}
+		enc = enc[76:]
+	}
+	_, err = io.WriteString(pw, enc+"\r\n")
+	return err
+}
+
+// messageID returns a new unique Message-ID for a mail from the given address.
+func messageID(from string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%x.%d@%s>", b, time.Now().UnixNano(), domain)
+}
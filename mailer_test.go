@@ -0,0 +1,150 @@
+package webfw
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/OpenDriversLog/webfw/mailtest"
+)
+
+// newMailTestApp returns an App sending mails to the given mailtest.Server, with the view "views/mail.txt".
+func newMailTestApp(s *mailtest.Server, user string) *App {
+	a := NewApp(&ServerConfig{RootDir: "/site", SmtpHost: s.Host, SmtpPort: s.Port, SmtpUser: user,
+		SmtpPassword: "secret", SmtpFrom: "ODL <noreply@example.com>"})
+	a.SetFS(fstest.MapFS{
+		"views/mail.txt": {Data: []byte(`Hello {[{.Data.name}]}`)},
+	})
+	return a
+}
+
+func testMail(name string) *Mail {
+	return &Mail{To: []string{"someone@example.com"}, Subject: "Test", TextView: "views/mail.txt",
+		Data: ViewData{Data: map[string]interface{}{"name": name}}}
+}
+
+// waitForMessages waits until s received n messages.
+func waitForMessages(t *testing.T, s *mailtest.Server, n int) []mailtest.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		msgs := s.Messages()
+		if len(msgs) >= n || time.Now().After(deadline) {
+			if len(msgs) != n {
+				t.Fatalf("received %d messages, want %d", len(msgs), n)
+			}
+			return msgs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMailerSend(t *testing.T) {
+	s, err := mailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := newMailTestApp(s, "odl").NewMailer(1)
+	defer m.Stop()
+
+	if err := m.Send(testMail("Bob")); err != nil {
+		t.Fatal(err)
+	}
+	msgs := s.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("received %d messages, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.User != "odl" || msg.TLS || msg.From != "noreply@example.com" ||
+		len(msg.To) != 1 || msg.To[0] != "someone@example.com" {
+		t.Errorf("received %+v", msg)
+	}
+	for _, want := range []string{"Subject: Test", "Content-Type: text/plain; charset=utf-8", "Hello Bob"} {
+		if !bytes.Contains(msg.Data, []byte(want)) {
+			t.Errorf("message does not contain %q :\n%s", want, msg.Data)
+		}
+	}
+}
+
+func TestMailerStartTLS(t *testing.T) {
+	s, err := mailtest.NewTLSServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := newMailTestApp(s, "odl").NewMailer(1)
+	defer m.Stop()
+
+	// The certificate of the Server is not trusted by default.
+	if err := m.Send(testMail("Bob")); err == nil {
+		t.Fatal("Send without the TLSConfig of the Server succeeded")
+	}
+	m.TLSConfig = s.ClientTLSConfig()
+	if err := m.Send(testMail("Bob")); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := s.Messages(); len(msgs) != 1 || !msgs[0].TLS || msgs[0].User != "odl" {
+		t.Errorf("received %+v, want one message sent authenticated after STARTTLS", msgs)
+	}
+}
+
+func TestMailerEnqueueRetries(t *testing.T) {
+	s, err := mailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := newMailTestApp(s, "").NewMailer(1)
+	m.RetryDelay = time.Millisecond
+	m.MaxAttempts = 3
+	failed := make(chan error, 1)
+	m.OnFailure = func(msg *MailMessage, err error) { failed <- err }
+
+	// Succeeds in the last attempt.
+	s.FailNext(2)
+	if err := m.Enqueue(testMail("Bob")); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessages(t, s, 1)
+
+	// Given up after MaxAttempts.
+	s.FailNext(3)
+	if err := m.Enqueue(testMail("Alice")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-failed:
+		if err == nil {
+			t.Error("OnFailure called without error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnFailure not called")
+	}
+	m.Stop()
+	waitForMessages(t, s, 1)
+}
+
+func TestMailerStopSendsQueuedMails(t *testing.T) {
+	s, err := mailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := newMailTestApp(s, "").NewMailer(2)
+
+	for i := 0; i < 5; i++ {
+		if err := m.Enqueue(testMail("Bob")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Stop()
+	if msgs := s.Messages(); len(msgs) != 5 {
+		t.Errorf("received %d messages after Stop, want 5", len(msgs))
+	}
+	if err := m.Enqueue(testMail("Bob")); err != ErrMailerStopped {
+		t.Errorf("Enqueue after Stop = %v, want ErrMailerStopped", err)
+	}
+	m.Stop()
+}
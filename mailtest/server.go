@@ -0,0 +1,278 @@
+// Package mailtest provides an in-process SMTP server to test code sending mails, e.g. using webfw.Mailer :
+//
+//	s, _ := mailtest.NewServer()
+//	defer s.Close()
+//	c.SmtpHost, c.SmtpPort = s.Host, s.Port
+//	... send ...
+//	msgs := s.Messages()
+//
+// Use NewTLSServer to test STARTTLS.
+package mailtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a mail received by the Server.
+type Message struct {
+	// User is the user name sent using AUTH PLAIN, if any.
+	User string
+	// TLS is set if the message was sent after STARTTLS.
+	TLS  bool
+	From string
+	To   []string
+	// Data contains the header & body, with the line endings & dot-stuffing of the SMTP transfer removed.
+	Data []byte
+}
+
+// Server is an SMTP server on 127.0.0.1 recording the received messages. It supports AUTH PLAIN
+// and, if created by NewTLSServer, STARTTLS.
+type Server struct {
+	// Host & Port the Server listens on.
+	Host string
+	Port string
+
+	tlsConfig *tls.Config
+	clientTLS *tls.Config
+	ln        net.Listener
+	wg        sync.WaitGroup
+	mutex     sync.Mutex
+	messages  []Message
+	failNext  int
+}
+
+// NewServer starts a new Server on a free port of 127.0.0.1.
+func NewServer() (*Server, error) {
+	return start(&Server{})
+}
+
+// NewTLSServer starts a new Server offering STARTTLS with a self-signed certificate for 127.0.0.1,
+// trusted by the config returned by ClientTLSConfig.
+func NewTLSServer() (*Server, error) {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	return start(&Server{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		clientTLS: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+	})
+}
+
+// start lets s listen on a free port of 127.0.0.1.
+func start(s *Server) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.ln = ln
+	s.Host, s.Port, _ = net.SplitHostPort(ln.Addr().String())
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// ClientTLSConfig returns a tls.Config trusting the certificate of a Server created by NewTLSServer, or nil.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	if s.clientTLS == nil {
+		return nil
+	}
+	return s.clientTLS.Clone()
+}
+
+// Addr returns the address the Server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Messages returns the messages received so far.
+func (s *Server) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// FailNext lets the Server answer the next n messages with a temporary error (451) instead of accepting them.
+func (s *Server) FailNext(n int) {
+	s.mutex.Lock()
+	s.failNext = n
+	s.mutex.Unlock()
+}
+
+// Close stops the Server and waits for its connections to end.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle speaks SMTP on a single connection.
+func (s *Server) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	c := textproto.NewConn(conn)
+	var msg Message
+	reply := func(code int, text string) bool {
+		return c.PrintfLine("%d %s", code, text) == nil
+	}
+	if !reply(220, "mailtest ESMTP") {
+		return
+	}
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+		ok := true
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			ok = c.PrintfLine("250-mailtest") == nil
+			if ok && s.tlsConfig != nil && !msg.TLS {
+				ok = c.PrintfLine("250-STARTTLS") == nil
+			}
+			ok = ok && reply(250, "AUTH PLAIN")
+		case "STARTTLS":
+			if s.tlsConfig == nil || msg.TLS {
+				ok = reply(502, "Command not implemented")
+				break
+			}
+			if !reply(220, "Ready to start TLS") {
+				return
+			}
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			// The client starts over with EHLO.
+			conn, c, msg = tlsConn, textproto.NewConn(tlsConn), Message{TLS: true}
+		case "HELO", "NOOP":
+			ok = reply(250, "OK")
+		case "AUTH":
+			fields := strings.Fields(arg)
+			if len(fields) != 2 || strings.ToUpper(fields[0]) != "PLAIN" {
+				ok = reply(504, "only AUTH PLAIN with initial response supported")
+				break
+			}
+			b, err := base64.StdEncoding.DecodeString(fields[1])
+			parts := strings.Split(string(b), "\x00")
+			if err != nil || len(parts) != 3 {
+				ok = reply(501, "invalid AUTH PLAIN response")
+				break
+			}
+			msg.User = parts[1]
+			ok = reply(235, "Authenticated")
+		case "MAIL":
+			msg.From = addrArg(arg)
+			msg.To = nil
+			ok = reply(250, "OK")
+		case "RCPT":
+			msg.To = append(msg.To, addrArg(arg))
+			ok = reply(250, "OK")
+		case "DATA":
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			fail := s.failNext > 0
+			if fail {
+				s.failNext--
+			} else {
+				m := msg
+				m.Data = data
+				s.messages = append(s.messages, m)
+			}
+			s.mutex.Unlock()
+			if fail {
+				ok = reply(451, "Temporary failure")
+			} else {
+				ok = reply(250, "OK")
+			}
+		case "RSET":
+			msg = Message{User: msg.User, TLS: msg.TLS}
+			ok = reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			ok = reply(502, "Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// addrArg returns the address of a "FROM:<a@b>" or "TO:<a@b>" argument.
+func addrArg(arg string) string {
+	if i := strings.IndexByte(arg, '<'); i >= 0 {
+		if j := strings.IndexByte(arg[i:], '>'); j >= 0 {
+			return arg[i+1 : i+j]
+		}
+	}
+	if i := strings.IndexByte(arg, ':'); i >= 0 {
+		return strings.TrimSpace(arg[i+1:])
+	}
+	return arg
+}
+
+// selfSignedCert returns a new self-signed certificate for 127.0.0.1 and a pool containing it.
+func selfSignedCert() (cert tls.Certificate, pool *x509.CertPool, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mailtest"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: parsed}, pool, nil
+}
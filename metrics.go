@@ -0,0 +1,236 @@
+package webfw
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MetricsBuckets are the upper bounds (in seconds) of the buckets of the duration histograms.
+var MetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// appMetrics are the metrics of an App, served by its MetricsHandler - the ViewEngines of the App share them.
+type appMetrics struct {
+	templateCacheHits   *counterVec
+	templateCacheMisses *counterVec
+	templateParseErrors *counterVec
+	renderDuration      *histogramVec
+	requestDuration     *histogramVec
+	pageCacheHits       *counterVec
+	pageCacheMisses     *counterVec
+	timeouts            *counterVec
+	panics              *counterVec
+}
+
+// newAppMetrics returns the metrics for a new App.
+func newAppMetrics() *appMetrics {
+	return &appMetrics{
+		templateCacheHits: newCounterVec("webfw_template_cache_hits_total",
+			"Templates returned by GetViewTemplate from the cache."),
+		templateCacheMisses: newCounterVec("webfw_template_cache_misses_total",
+			"Templates parsed by GetViewTemplate because they were not cached."),
+		templateParseErrors: newCounterVec("webfw_template_parse_errors_total",
+			"Templates GetViewTemplate could not read or parse."),
+		renderDuration: newHistogramVec("webfw_render_duration_seconds",
+			"Time spent executing templates by ViewName.", "view"),
+		requestDuration: newHistogramVec("webfw_request_duration_seconds",
+			"Time spent in MvcHandler by binder key & status code.", "binder", "code"),
+		pageCacheHits: newCounterVec("webfw_page_cache_hits_total",
+			"Pages served by MvcHandler from the PageCache by binder key.", "binder"),
+		pageCacheMisses: newCounterVec("webfw_page_cache_misses_total",
+			"Pages rendered by MvcHandler because they were not in the PageCache by binder key.", "binder"),
+		timeouts: newCounterVec("webfw_timeouts_total",
+			"Requests answered with the TimeoutMessage by WrapWithInit."),
+		panics: newCounterVec("webfw_panics_total",
+			"Panics caught by handler.", "handler"),
+	}
+}
+
+// MetricsHandler serves the metrics of the App in the Prometheus text exposition format - bind it e.g. to "/metrics".
+// Every App counts on its own, so the metrics of several Apps in one process are not mixed.
+func (a *App) MetricsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := a.metrics
+	for _, c := range []interface{ write(io.Writer) }{
+		m.templateCacheHits, m.templateCacheMisses, m.templateParseErrors, m.renderDuration, m.requestDuration,
+		m.pageCacheHits, m.pageCacheMisses, m.timeouts, m.panics,
+	} {
+		c.write(w)
+	}
+
+	v := a.Views()
+	v.tempCacheMutex.Lock()
+	templates := len(v.templateCache)
+	v.tempCacheMutex.Unlock()
+	writeGauge(w, "webfw_template_cache_entries", "Templates in the template cache.", float64(templates))
+
+	a.fileCache.RLock()
+	files, size := len(a.fileCache.m), 0
+	for _, b := range a.fileCache.m {
+		size += len(b)
+	}
+	a.fileCache.RUnlock()
+	writeGauge(w, "webfw_file_cache_entries", "Files in the FileCache.", float64(files))
+	writeGauge(w, "webfw_file_cache_bytes", "Size of the files in the FileCache.", float64(size))
+	writeGauge(w, "webfw_page_cache_entries", "Pages in the in-memory PageStore.", float64(a.pageStore.Len()))
+}
+
+// metricVec contains the name, help & label names shared by counters & histograms.
+type metricVec struct {
+	sync.Mutex
+	name   string
+	help   string
+	labels []string
+}
+
+// labelKey joins the given label values to a map key.
+func (m *metricVec) labelKey(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("%s : got %d label values for %d labels", m.name, len(values), len(m.labels)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString formats the labels for the given map key, adding the extra label (e.g. le="0.5") if given.
+func (m *metricVec) labelString(key string, extra ...string) string {
+	var pairs []string
+	if len(m.labels) != 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, m.labels[i]+`="`+escapeLabel(v)+`"`)
+		}
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabel(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeHeader writes the HELP & TYPE lines.
+func (m *metricVec) writeHeader(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, typ)
+}
+
+// counterVec is a counter with labels.
+type counterVec struct {
+	metricVec
+	values map[string]float64
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{metricVec: metricVec{name: name, help: help, labels: labels}, values: make(map[string]float64)}
+}
+
+// inc increments the counter with the given label values.
+func (c *counterVec) inc(labelValues ...string) {
+	key := c.labelKey(labelValues)
+	c.Lock()
+	c.values[key]++
+	c.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.writeHeader(w, "counter")
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, key := range sortedMetricKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(key), formatMetric(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with labels using MetricsBuckets.
+type histogramVec struct {
+	metricVec
+	values map[string]*histogram
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogramVec(name string, help string, labels ...string) *histogramVec {
+	return &histogramVec{metricVec: metricVec{name: name, help: help, labels: labels}, values: make(map[string]*histogram)}
+}
+
+// observe adds the given duration to the histogram with the given label values.
+func (h *histogramVec) observe(d time.Duration, labelValues ...string) {
+	key := h.labelKey(labelValues)
+	s := d.Seconds()
+	h.Lock()
+	defer h.Unlock()
+	v := h.values[key]
+	if v == nil {
+		v = &histogram{buckets: make([]uint64, len(MetricsBuckets))}
+		h.values[key] = v
+	}
+	for i, le := range MetricsBuckets {
+		if s <= le {
+			v.buckets[i]++
+		}
+	}
+	v.count++
+	v.sum += s
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	h.writeHeader(w, "histogram")
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := h.values[key]
+		for i, le := range MetricsBuckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", formatMetric(le)), v.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(key), formatMetric(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(key), v.count)
+	}
+}
+
+// writeGauge writes a gauge without labels.
+func writeGauge(w io.Writer, name string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatMetric(value))
+}
+
+// sortedMetricKeys returns the keys of the given map in order.
+func sortedMetricKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatMetric formats a sample value.
+func formatMetric(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes a label value for the text exposition format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
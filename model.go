@@ -3,6 +3,7 @@ package webfw
 type IModel interface {
 	// because of http://stackoverflow.com/questions/19554209/template-wont-evaluate-fields-that-are-interface-type-as-the-underlying-type
 	// we need this "Custom" to get access the data that is extended by our individual models.
+	// Use ViewDataOf to let templates access a typed model directly.
 	C() interface{}
 }
 type Model struct {
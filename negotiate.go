@@ -0,0 +1,383 @@
+package webfw
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Compufreak345/dbg"
+)
+
+const nTag = dbg.Tag("webfw/negotiate.go")
+
+// FormatHTML is the format rendered using the view returned by the Controller.
+const FormatHTML = "html"
+
+// Renderer serializes the ViewData returned by a Controller when the client asks for its format,
+// either by the ?format= parameter or the Accept header, and the MVCBinder allows it in Formats.
+type Renderer struct {
+	// Format is the value of the ?format= parameter, e.g. "json".
+	Format string
+	// MediaTypes are matched against the Accept header, the first one is sent as Content-Type.
+	MediaTypes []string
+	Render     func(w io.Writer, d *SerializedViewData) error
+}
+
+// SerializedViewData is the part of the ViewData serialized by a Renderer.
+type SerializedViewData struct {
+	XMLName        xml.Name               `json:"-" xml:"viewData"`
+	View           string                 `json:"view,omitempty" xml:"view,omitempty"`
+	Model          interface{}            `json:"model,omitempty" xml:"model,omitempty"`
+	Data           map[string]interface{} `json:"data,omitempty" xml:"-"`
+	XMLData        xmlMap                 `json:"-" xml:"data,omitempty"`
+	Redirect       string                 `json:"redirect,omitempty" xml:"redirect,omitempty"`
+	ErrorType      int                    `json:"errorType,omitempty" xml:"errorType,omitempty"`
+	ErrorMessage   string                 `json:"errorMessage,omitempty" xml:"errorMessage,omitempty"`
+	ErrorDetail    string                 `json:"errorDetail,omitempty" xml:"errorDetail,omitempty"`
+	WarningMessage string                 `json:"warningMessage,omitempty" xml:"warningMessage,omitempty"`
+	StatusMessage  string                 `json:"statusMessage,omitempty" xml:"statusMessage,omitempty"`
+	FieldErrors    FieldErrors            `json:"fieldErrors,omitempty" xml:"fieldErrors>fieldError,omitempty"`
+}
+
+var renderers = struct {
+	sync.RWMutex
+	m map[string]Renderer
+}{m: map[string]Renderer{
+	"json": {Format: "json", MediaTypes: []string{"application/json"}, Render: renderJSON},
+	"xml":  {Format: "xml", MediaTypes: []string{"application/xml", "text/xml"}, Render: renderXML},
+	"csv":  {Format: "csv", MediaTypes: []string{"text/csv"}, Render: renderCSV},
+}}
+
+// RegisterRenderer adds or replaces the Renderer for r.Format.
+func RegisterRenderer(r Renderer) {
+	renderers.Lock()
+	renderers.m[r.Format] = r
+	renderers.Unlock()
+}
+
+// getRenderer returns the Renderer registered for the given format.
+func getRenderer(format string) (r Renderer, ok bool) {
+	renderers.RLock()
+	r, ok = renderers.m[format]
+	renderers.RUnlock()
+	return
+}
+
+// negotiateFormat returns the format the client asked for - FormatHTML if it did not ask for one of the allowed
+// formats with a registered Renderer. ok is false if the ?format= parameter names another format.
+func negotiateFormat(r *http.Request, allowed []string) (format string, ok bool) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f == FormatHTML {
+			return f, true
+		}
+		if !formatAllowed(f, allowed) {
+			return f, false
+		}
+		_, ok = getRenderer(f)
+		return f, ok
+	}
+
+	format = FormatHTML
+	bestQ := 0.0
+	renderers.RLock()
+	defer renderers.RUnlock()
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		switch mt {
+		case "text/html", "application/xhtml+xml", "*/*":
+			format, bestQ = FormatHTML, q
+			continue
+		}
+		for f, rd := range renderers.m {
+			if !formatAllowed(f, allowed) {
+				continue
+			}
+			for _, rmt := range rd.MediaTypes {
+				if rmt == mt {
+					format, bestQ = f, q
+				}
+			}
+		}
+	}
+	return format, true
+}
+
+// formatAllowed returns whether format is one of the allowed formats.
+func formatAllowed(format string, allowed []string) bool {
+	for _, f := range allowed {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// newSerializedViewData returns the SerializedViewData of the given ViewData.
+func newSerializedViewData(vd ViewData) *SerializedViewData {
+	d := &SerializedViewData{
+		View:           vd.ViewName,
+		Data:           vd.Data,
+		XMLData:        xmlMap(vd.Data),
+		Redirect:       vd.Redirect,
+		ErrorType:      vd.ErrorType,
+		ErrorDetail:    vd.ErrorDetail,
+		ErrorMessage:   messageString(vd.ErrorMessage),
+		WarningMessage: messageString(vd.WarningMessage),
+		StatusMessage:  messageString(vd.StatusMessage),
+		FieldErrors:    vd.FieldErrors,
+	}
+	if vd.Model != nil {
+		d.Model = vd.Model.C()
+	}
+	return d
+}
+
+// messageString converts one of the messages of a ViewData to a string.
+func messageString(msg interface{}) string {
+	if msg == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", msg)
+}
+
+// writeSerialized renders the given ViewData using the Renderer for format, responding with the given status.
+func (a *App) writeSerialized(w http.ResponseWriter, format string, vd ViewData, status int) {
+	rd, _ := getRenderer(format)
+	var b bytes.Buffer
+	if err := rd.Render(&b, newSerializedViewData(vd)); err != nil {
+		dbg.E(nTag, "Error rendering %s : %v", format, err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	w.Header().Set("Content-Type", rd.MediaTypes[0]+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b.Bytes())
+}
+
+// serializedError responds with the error of the given ViewData using the Renderer for format.
+// Model & Data are left out, as they may be incomplete.
+func (a *App) serializedError(w http.ResponseWriter, format string, vd ViewData, err error) {
+	vd = ViewData{ViewName: vd.ViewName, ErrorType: vd.ErrorType, ErrorSource: vd.ErrorSource, ErrorMessage: vd.ErrorMessage}
+	if vd.ErrorSource == "" {
+		vd.ErrorSource = hTag
+	}
+	if vd.ErrorType == 0 {
+		vd.ErrorType = 500
+	}
+	if vd.ErrorMessage == nil || vd.ErrorMessage == "" {
+		vd.ErrorMessage = http.StatusText(vd.ErrorType)
+	}
+	dbg.I(nTag, "Error %d rendered as %s : Source : %v ClientMessage : %v Error : %v", vd.ErrorType, format, vd.ErrorSource, vd.ErrorMessage, err)
+	if err != nil && a.Profile().ErrorDetail == ErrorDetailFull {
+		vd.ErrorDetail = fmt.Sprintf("%s : %v", vd.ErrorSource, err)
+	}
+	a.writeSerialized(w, format, vd, vd.ErrorType)
+}
+
+func renderJSON(w io.Writer, d *SerializedViewData) error {
+	return json.NewEncoder(w).Encode(d)
+}
+
+func renderXML(w io.Writer, d *SerializedViewData) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(d)
+}
+
+// renderCSV writes the Model as CSV : a slice of structs or maps becomes a header & a row per element,
+// a single struct or map a header & one row. Without a Model, Data is written as key/value rows.
+func renderCSV(w io.Writer, d *SerializedViewData) error {
+	cw := csv.NewWriter(w)
+	var records [][]string
+	if d.Model != nil {
+		records = csvRecords(reflect.ValueOf(d.Model))
+	} else {
+		records = [][]string{{"key", "value"}}
+		for _, k := range sortedKeys(d.Data) {
+			records = append(records, []string{k, fmt.Sprint(d.Data[k])})
+		}
+	}
+	return cw.WriteAll(records)
+}
+
+// csvRecords converts the given value to CSV records, see renderCSV. Nil elements of a slice become empty records.
+func csvRecords(v reflect.Value) (records [][]string) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	var rows []reflect.Value
+	elem := v.Type()
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		elem = elem.Elem()
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, csvRow(v.Index(i)))
+		}
+	} else {
+		rows = []reflect.Value{v}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Interface {
+		// e.g. []interface{} : the first non-nil element decides, rows of other types are written empty
+		for _, row := range rows {
+			if row.IsValid() {
+				elem = row.Type()
+				break
+			}
+		}
+		for i, row := range rows {
+			if row.IsValid() && row.Type() != elem && (elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map) {
+				rows[i] = reflect.Value{}
+			}
+		}
+	}
+
+	switch elem.Kind() {
+	case reflect.Struct:
+		var header []int
+		var names []string
+		for i := 0; i < elem.NumField(); i++ {
+			if f := elem.Field(i); f.PkgPath == "" {
+				header = append(header, i)
+				names = append(names, f.Name)
+			}
+		}
+		records = append(records, names)
+		for _, row := range rows {
+			rec := make([]string, len(header))
+			if row.IsValid() {
+				for j, i := range header {
+					rec[j] = fmt.Sprint(row.Field(i).Interface())
+				}
+			}
+			records = append(records, rec)
+		}
+	case reflect.Map:
+		// the columns are the keys of the first non-nil map, looked up by their reflect.Value
+		var keys []reflect.Value
+		var names []string
+		for _, row := range rows {
+			if row.IsValid() && !row.IsNil() {
+				keys = row.MapKeys()
+				break
+			}
+		}
+		for _, k := range keys {
+			names = append(names, fmt.Sprint(k.Interface()))
+		}
+		sort.Sort(csvColumns{keys, names})
+		records = append(records, names)
+		for _, row := range rows {
+			rec := make([]string, len(keys))
+			if row.IsValid() && !row.IsNil() {
+				for j, k := range keys {
+					if val := row.MapIndex(k); val.IsValid() {
+						rec[j] = fmt.Sprint(val.Interface())
+					}
+				}
+			}
+			records = append(records, rec)
+		}
+	default:
+		for _, row := range rows {
+			if row.IsValid() {
+				records = append(records, []string{fmt.Sprint(row.Interface())})
+			} else {
+				records = append(records, []string{""})
+			}
+		}
+	}
+	return
+}
+
+// csvRow dereferences a slice element, returning the zero Value for nil pointers & interfaces.
+func csvRow(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// csvColumns sorts map keys by their formatted names.
+type csvColumns struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (c csvColumns) Len() int           { return len(c.names) }
+func (c csvColumns) Less(i, j int) bool { return c.names[i] < c.names[j] }
+func (c csvColumns) Swap(i, j int) {
+	c.keys[i], c.keys[j] = c.keys[j], c.keys[i]
+	c.names[i], c.names[j] = c.names[j], c.names[i]
+}
+
+// xmlMap marshals a map as a list of entries, as encoding/xml does not support maps.
+type xmlMap map[string]interface{}
+
+func (m xmlMap) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(m) == 0 {
+		return nil
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(m) {
+		entry := xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}}}
+		var err error
+		if sub, ok := m[k].(map[string]interface{}); ok {
+			err = e.EncodeElement(xmlMap(sub), entry)
+		} else {
+			err = e.EncodeElement(m[k], entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// sortedKeys returns the keys of the given map in order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,42 @@
+package webfw
+
+import (
+	"reflect"
+	"testing"
+)
+
+type csvTestRow struct {
+	ID   int
+	Name string
+	note string
+}
+
+func TestCsvRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		model interface{}
+		want  [][]string
+	}{
+		{"nil", nil, nil},
+		{"empty slice", []csvTestRow{}, nil},
+		{"struct", csvTestRow{1, "a", "x"}, [][]string{{"ID", "Name"}, {"1", "a"}}},
+		{"struct pointer", &csvTestRow{1, "a", "x"}, [][]string{{"ID", "Name"}, {"1", "a"}}},
+		{"structs", []csvTestRow{{1, "a", ""}, {2, "b", ""}}, [][]string{{"ID", "Name"}, {"1", "a"}, {"2", "b"}}},
+		{"struct pointers with nil", []*csvTestRow{{1, "a", ""}, nil}, [][]string{{"ID", "Name"}, {"1", "a"}, {"", ""}}},
+		{"only nil struct pointers", []*csvTestRow{nil}, [][]string{{"ID", "Name"}, {"", ""}}},
+		{"string maps", []map[string]int{{"b": 2, "a": 1}, {"a": 3}}, [][]string{{"a", "b"}, {"1", "2"}, {"3", ""}}},
+		{"int maps", []map[int]string{{2: "b", 1: "a"}}, [][]string{{"1", "2"}, {"a", "b"}}},
+		{"nil map first", []map[string]int{nil, {"a": 1}}, [][]string{{"a"}, {""}, {"1"}}},
+		{"map", map[string]string{"k": "v"}, [][]string{{"k"}, {"v"}}},
+		{"interfaces", []interface{}{csvTestRow{1, "a", ""}, nil, "other"}, [][]string{{"ID", "Name"}, {"1", "a"}, {"", ""}, {"", ""}}},
+		{"scalars", []int{1, 2}, [][]string{{"1"}, {"2"}}},
+		{"scalar pointers with nil", []*int{nil}, [][]string{{""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvRecords(reflect.ValueOf(tt.model)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("csvRecords(%#v) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
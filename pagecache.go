@@ -0,0 +1,372 @@
+package webfw
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Compufreak345/dbg"
+	"github.com/OpenDriversLog/goodl-lib/translate"
+	"github.com/garyburd/redigo/redis"
+	"golang.org/x/net/context"
+)
+
+const pcTag = dbg.Tag("webfw/pagecache.go")
+
+// PageCacheHeader is set to "HIT" or "MISS" on every response of an MVCBinder with a PageCache.
+const PageCacheHeader = "X-Page-Cache"
+
+// PageCache caches the rendered output of an MVCBinder, so GetViewData & the template run once per TTL
+// instead of on every request. Use it only for pages that look the same for every visitor (e.g. landing & help pages).
+//
+// Pages are cached by path & query, language (T.UrlLang of the context), negotiated format, requested fragment and
+// the values of the VaryHeaders. Only anonymous GET & HEAD requests answered with 200 are cached : requests with an
+// Authorization header or a session cookie (see SessionCookies) bypass the cache, responses setting a cookie
+// or sending "Cache-Control: private" or "no-store" are not stored.
+type PageCache struct {
+	TTL time.Duration
+	// VaryHeaders are the request headers whose values become part of the cache key, e.g. "Accept-Encoding".
+	VaryHeaders []string
+	// SessionCookies are the names of the cookies identifying a visitor, e.g. the session cookie.
+	// Requests carrying one of them bypass the cache - if nil, requests carrying any cookie do.
+	SessionCookies []string
+	// Skip decides whether further requests bypass the cache.
+	Skip func(ctx context.Context, r *http.Request) bool
+	// Store holds the pages - the MemoryPageStore of the App if nil. Use a RedisPageStore to share them between servers.
+	Store PageStore
+}
+
+// CachedPage is a response stored in a PageStore.
+type CachedPage struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// PageStore stores CachedPages by key.
+type PageStore interface {
+	Get(key string) (p *CachedPage, ok bool)
+	Set(key string, p *CachedPage, ttl time.Duration) error
+	// DeletePrefix evicts all pages whose key starts with prefix ("" for all) and returns their keys.
+	DeletePrefix(prefix string) (evicted []string, err error)
+}
+
+// DefaultPageCacheEntries is the MaxEntries of new MemoryPageStores.
+var DefaultPageCacheEntries = 1000
+
+// MemoryPageStore is a PageStore keeping the pages in memory.
+type MemoryPageStore struct {
+	sync.RWMutex
+	m map[string]memoryPage
+	// MaxEntries limits the number of pages - when reached, expired pages are removed and new pages are not stored
+	// until there is room again.
+	MaxEntries int
+}
+
+// memoryPage is a CachedPage of a MemoryPageStore with its expiry.
+type memoryPage struct {
+	page    *CachedPage
+	expires time.Time
+}
+
+// NewMemoryPageStore returns a new MemoryPageStore with DefaultPageCacheEntries as MaxEntries.
+func NewMemoryPageStore() *MemoryPageStore {
+	return &MemoryPageStore{m: make(map[string]memoryPage), MaxEntries: DefaultPageCacheEntries}
+}
+
+func (s *MemoryPageStore) Get(key string) (*CachedPage, bool) {
+	s.RLock()
+	e, ok := s.m[key]
+	s.RUnlock()
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.page, true
+}
+
+func (s *MemoryPageStore) Set(key string, p *CachedPage, ttl time.Duration) error {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.m[key]; !ok && s.MaxEntries > 0 && len(s.m) >= s.MaxEntries {
+		for k, e := range s.m {
+			if now.After(e.expires) {
+				delete(s.m, k)
+			}
+		}
+		if len(s.m) >= s.MaxEntries {
+			dbg.W(pcTag, "MemoryPageStore is full (%d pages) - not caching %s", len(s.m), key)
+			return nil
+		}
+	}
+	s.m[key] = memoryPage{page: p, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryPageStore) DeletePrefix(prefix string) (evicted []string, err error) {
+	s.Lock()
+	for k := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.m, k)
+			evicted = append(evicted, k)
+		}
+	}
+	s.Unlock()
+	sort.Strings(evicted)
+	return
+}
+
+// Len returns the number of pages in the MemoryPageStore, including expired ones not removed yet.
+func (s *MemoryPageStore) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.m)
+}
+
+// RedisPageStore is a PageStore keeping the pages in Redis, using the connection pool of the SessionStore of its App.
+type RedisPageStore struct {
+	app *App
+	// Prefix is prepended to the keys in Redis.
+	Prefix string
+}
+
+// NewRedisPageStore returns a new RedisPageStore using the SessionStore of the App, prefixing its keys with "webfw:page:".
+func (a *App) NewRedisPageStore() *RedisPageStore {
+	return &RedisPageStore{app: a, Prefix: "webfw:page:"}
+}
+
+// conn returns a connection of the pool of the SessionStore - the SessionStore is created by the first request.
+func (s *RedisPageStore) conn() (redis.Conn, bool) {
+	store := s.app.SessionStore()
+	if store == nil || store.Pool == nil {
+		return nil, false
+	}
+	return store.Pool.Get(), true
+}
+
+func (s *RedisPageStore) Get(key string) (*CachedPage, bool) {
+	conn, ok := s.conn()
+	if !ok {
+		return nil, false
+	}
+	defer conn.Close()
+	b, err := redis.Bytes(conn.Do("GET", s.Prefix+key))
+	if err != nil {
+		if err != redis.ErrNil {
+			dbg.W(pcTag, "Error reading page %s from Redis : %v", key, err)
+		}
+		return nil, false
+	}
+	p := &CachedPage{}
+	if err := json.Unmarshal(b, p); err != nil {
+		dbg.W(pcTag, "Error decoding page %s from Redis : %v", key, err)
+		return nil, false
+	}
+	return p, true
+}
+
+func (s *RedisPageStore) Set(key string, p *CachedPage, ttl time.Duration) error {
+	conn, ok := s.conn()
+	if !ok {
+		return nil
+	}
+	defer conn.Close()
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ms := ttl.Nanoseconds() / int64(time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	_, err = conn.Do("SET", s.Prefix+key, b, "PX", ms)
+	return err
+}
+
+func (s *RedisPageStore) DeletePrefix(prefix string) (evicted []string, err error) {
+	conn, ok := s.conn()
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	cursor := "0"
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", redisGlobEscape(s.Prefix+prefix)+"*", "COUNT", 100))
+		if err != nil {
+			return evicted, err
+		}
+		var keys []string
+		if _, err = redis.Scan(values, &cursor, &keys); err != nil {
+			return evicted, err
+		}
+		for _, k := range keys {
+			if _, err = conn.Do("DEL", k); err != nil {
+				return evicted, err
+			}
+			evicted = append(evicted, strings.TrimPrefix(k, s.Prefix))
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	sort.Strings(evicted)
+	return
+}
+
+// redisGlobEscape escapes the characters with a special meaning in the patterns of SCAN MATCH.
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// PageStore returns the MemoryPageStore used by the PageCaches of the App without Store.
+func (a *App) PageStore() *MemoryPageStore {
+	return a.pageStore
+}
+
+// pageStoreFor returns the PageStore of the given PageCache.
+func (a *App) pageStoreFor(pc *PageCache) PageStore {
+	if pc.Store != nil {
+		return pc.Store
+	}
+	return a.pageStore
+}
+
+// pageStores returns the distinct PageStores of the App & its MVCBinders.
+func (a *App) pageStores() (stores []PageStore) {
+	stores = append(stores, a.pageStore)
+	seen := map[PageStore]bool{a.pageStore: true}
+	for _, b := range a.Binders() {
+		if b.Cache != nil && b.Cache.Store != nil && !seen[b.Cache.Store] {
+			seen[b.Cache.Store] = true
+			stores = append(stores, b.Cache.Store)
+		}
+	}
+	return
+}
+
+// InvalidatePages evicts the cached pages whose path starts with prefix (including SubDir, e.g. "/alpha/help")
+// from all PageStores of the App. Pass "" to evict all pages. It returns the evicted cache keys.
+func (a *App) InvalidatePages(prefix string) (evicted []string) {
+	for _, s := range a.pageStores() {
+		keys, err := s.DeletePrefix(prefix)
+		if err != nil {
+			dbg.W(pcTag, "Error invalidating pages with prefix %q : %v", prefix, err)
+		}
+		evicted = append(evicted, keys...)
+	}
+	return
+}
+
+// cacheable returns whether the response to r may be served from & stored in the PageCache.
+func (pc *PageCache) cacheable(ctx context.Context, r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || pc.hasSessionCookie(r) {
+		return false
+	}
+	return pc.Skip == nil || !pc.Skip(ctx, r)
+}
+
+// hasSessionCookie returns whether r carries one of the SessionCookies - or any cookie if there are none.
+func (pc *PageCache) hasSessionCookie(r *http.Request) bool {
+	if pc.SessionCookies == nil {
+		return len(r.Cookies()) != 0
+	}
+	for _, name := range pc.SessionCookies {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the cache key of r - it starts with the escaped path, so pages can be invalidated by path prefix.
+// The parts are separated by spaces, which can not occur in them.
+func (pc *PageCache) key(ctx context.Context, r *http.Request, format string) string {
+	var b strings.Builder
+	b.WriteString(r.URL.EscapedPath())
+	if r.URL.RawQuery != "" {
+		b.WriteString("?" + r.URL.RawQuery)
+	}
+	lang := ""
+	if T, ok := ctx.Value("T").(*translate.Translater); ok && T != nil {
+		lang = T.UrlLang
+	}
+	b.WriteString(" lang=" + url.QueryEscape(lang) + " format=" + url.QueryEscape(format) +
+		" fragment=" + url.QueryEscape(requestedFragment(r)))
+	for _, h := range pc.VaryHeaders {
+		b.WriteString(" " + http.CanonicalHeaderKey(h) + "=" + url.QueryEscape(r.Header.Get(h)))
+	}
+	return b.String()
+}
+
+// write sends the CachedPage to w.
+func (p *CachedPage) write(w http.ResponseWriter, r *http.Request) {
+	for k, v := range p.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.Header().Set(PageCacheHeader, "HIT")
+	w.WriteHeader(p.Status)
+	if r.Method != "HEAD" {
+		w.Write(p.Body)
+	}
+}
+
+// pageRecorder passes a response through to the wrapped http.ResponseWriter, recording it for the PageCache.
+type pageRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+	// skip prevents caching the response.
+	skip bool
+}
+
+func (w *pageRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.ResponseWriter.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *pageRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(200)
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the wrapped http.ResponseWriter if it supports it.
+func (w *pageRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// page returns the recorded response as CachedPage or false if it must not be cached.
+func (w *pageRecorder) page() (*CachedPage, bool) {
+	if w.skip || w.status != 200 || w.header.Get("Set-Cookie") != "" {
+		return nil, false
+	}
+	cc := strings.ToLower(w.header.Get("Cache-Control"))
+	if strings.Contains(cc, "private") || strings.Contains(cc, "no-store") {
+		return nil, false
+	}
+	w.header.Del(PageCacheHeader)
+	return &CachedPage{Status: w.status, Header: w.header, Body: w.body.Bytes()}, true
+}
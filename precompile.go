@@ -0,0 +1,120 @@
+package webfw
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/Compufreak345/dbg"
+)
+
+// Precompile parses every view under RootDir/views against the shared templates declared by the MVCBinders using it
+// (see MVCBinder.View) into the template cache, so no template is parsed in a request.
+// It returns nil or TemplateErrors containing every view & shared template that could not be parsed and a warning
+// for every MVCBinder without a View : its Controller only chooses the shared template at request time,
+// so its view is parsed in the first request using it - use TemplateErrors.Failed to ignore the warnings.
+// A precompiled App also precompiles the ViewEngine of a reloaded config and rejects the reload on errors.
+func (a *App) Precompile() error {
+	// Set first, so a ViewEngine swapped in meanwhile is precompiled too.
+	a.configMutex.Lock()
+	a.precompiled = true
+	a.configMutex.Unlock()
+	return a.Views().precompile(a.Config(), a.Binders())
+}
+
+// isPrecompiled returns whether Precompile was called.
+func (a *App) isPrecompiled() bool {
+	a.configMutex.RLock()
+	defer a.configMutex.RUnlock()
+	return a.precompiled
+}
+
+// listViews returns the paths (relative to RootDir) of all views under RootDir/views, except the shared templates.
+func (v *ViewEngine) listViews(c *ServerConfig) (views []string, err error) {
+	sharedDir := fsName(c.RootDir, sharedTemplateDir(c))
+	err = fs.WalkDir(siteFS(c, v.fsys), "views", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == sharedDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(d.Name(), ".") && !strings.HasSuffix(d.Name(), ViewSidecarSuffix) {
+			views = append(views, p)
+		}
+		return nil
+	})
+	return
+}
+
+// precompile parses all views of the given config into the cache of the ViewEngine.
+func (v *ViewEngine) precompile(c *ServerConfig, binders map[string]MVCBinder) error {
+	dbg.I(vTag, "Start precompile")
+	errs := append(TemplateErrors{}, v.sharedErrors...)
+
+	// The shared templates each view is rendered with.
+	sharedByView := make(map[string][]string)
+	var undeclared []string
+	for key, b := range binders {
+		if b.View != "" {
+			sharedByView[b.View] = append(sharedByView[b.View], b.SharedTemplate)
+		} else if b.Ctrl != nil {
+			undeclared = append(undeclared, key)
+		}
+	}
+	sort.Strings(undeclared)
+
+	views, err := v.listViews(c)
+	if err != nil {
+		errs = append(errs, &TemplateError{File: c.RootDir + "/views", Message: err.Error(), Err: err})
+	}
+	// Views declared by binders but outside of RootDir/views
+	for view := range sharedByView {
+		if !strings.HasPrefix(view, "views/") {
+			views = append(views, view)
+		}
+	}
+	sort.Strings(views)
+
+	for _, vPath := range views {
+		shared := sharedByView[vPath]
+		if len(shared) == 0 {
+			shared = []string{""}
+		}
+		for _, s := range shared {
+			t, err := v.parseView(vPath, c.RootDir+"/"+vPath, s)
+			if err != nil {
+				if te, ok := err.(*TemplateError); ok {
+					errs = append(errs, te)
+				} else {
+					errs = append(errs, &TemplateError{File: vPath, Message: err.Error(), Err: err})
+				}
+				continue
+			}
+			key := templateCacheKey(vPath, normalizeLayout(s))
+			v.tempCacheMutex.Lock()
+			v.templateCache[key] = t
+			v.addDeps(key, c.RootDir+"/"+vPath, s)
+			v.tempCacheMutex.Unlock()
+		}
+	}
+
+	for _, key := range undeclared {
+		errs = append(errs, &TemplateError{File: "binder " + key,
+			Message: "no View declared, its view is parsed at request time", Warning: true})
+	}
+
+	if len(errs.Failed()) != 0 {
+		dbg.E(vTag, "End precompile with errors : %v", errs)
+		return errs
+	}
+	if len(errs) != 0 {
+		dbg.W(vTag, "End precompile with warnings : %v", errs)
+		return errs
+	}
+	dbg.I(vTag, "End precompile - %d views", len(views))
+	return nil
+}
@@ -0,0 +1,28 @@
+package webfw
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestPrecompileWarnsForBindersWithoutView(t *testing.T) {
+	a := NewApp(&ServerConfig{RootDir: "/site"})
+	a.SetFS(fstest.MapFS{
+		"views/shared/base.html": {Data: []byte(`{[{define "base"}]}x{[{template "content" .}]}{[{end}]}`)},
+		"views/a.html":           {Data: []byte(`{[{define "content"}]}a{[{end}]}`)},
+	})
+	a.SetBinder("declared", MVCBinder{Ctrl: ControllerFunc(nil), View: "views/a.html", SharedTemplate: "base.html"})
+	a.SetBinder("undeclared", MVCBinder{Ctrl: ControllerFunc(nil)})
+
+	errs, ok := a.Precompile().(TemplateErrors)
+	if !ok || len(errs) != 1 || !errs[0].Warning || errs[0].File != "binder undeclared" {
+		t.Fatalf("Precompile() = %v, want a warning for binder undeclared", errs)
+	}
+	if failed := errs.Failed(); len(failed) != 0 {
+		t.Errorf("Failed() = %v, want none", failed)
+	}
+	// Warnings do not reject the ViewEngine of a precompiled App.
+	if _, errs := a.newViewEngine(a.Config()); len(errs) != 0 {
+		t.Errorf("newViewEngine() errors = %v, want none", errs)
+	}
+}
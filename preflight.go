@@ -0,0 +1,167 @@
+package webfw
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Compufreak345/dbg"
+	"github.com/garyburd/redigo/redis"
+)
+
+const pTag = dbg.Tag("webfw/preflight.go")
+
+// PreflightTimeout is the time Preflight waits for Redis to answer.
+var PreflightTimeout = 3 * time.Second
+
+// PreflightCheck is the result of a single check done by Preflight.
+type PreflightCheck struct {
+	Name string
+	// Err is nil if the check passed.
+	Err error
+	// Note contains additional information, e.g. why a check was skipped.
+	Note string
+}
+
+// PreflightReport contains the results of all checks done by Preflight.
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// OK returns true if all checks passed.
+func (r *PreflightReport) OK() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the checks that did not pass.
+func (r *PreflightReport) Failed() (failed []PreflightCheck) {
+	for _, c := range r.Checks {
+		if c.Err != nil {
+			failed = append(failed, c)
+		}
+	}
+	return
+}
+
+// Print writes a human readable report to w.
+func (r *PreflightReport) Print(w io.Writer) {
+	for _, c := range r.Checks {
+		switch {
+		case c.Err != nil:
+			fmt.Fprintf(w, "FAIL  %s : %v\n", c.Name, c.Err)
+		case c.Note != "":
+			fmt.Fprintf(w, "ok    %s (%s)\n", c.Name, c.Note)
+		default:
+			fmt.Fprintf(w, "ok    %s\n", c.Name)
+		}
+	}
+	fmt.Fprintf(w, "%d checks, %d failed\n", len(r.Checks), len(r.Failed()))
+}
+
+// PreflightOptions allows to skip checks of Preflight.
+type PreflightOptions struct {
+	SkipRedis bool
+}
+
+func (r *PreflightReport) add(name string, err error, note string) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Err: err, Note: note})
+}
+
+// Preflight checks the given App (the default App if nil) before serving requests :
+// the ServerConfig (including RootDir & SharedDir), every shared template, every view under RootDir/views,
+// the views declared by the registered MVCBinders and whether Redis answers.
+func Preflight(a *App) *PreflightReport {
+	return PreflightWithOptions(a, PreflightOptions{})
+}
+
+// PreflightWithOptions is Preflight with the checks skipped by the given options.
+func PreflightWithOptions(a *App, opts PreflightOptions) *PreflightReport {
+	if a == nil {
+		a = defaultApp
+	}
+	dbg.I(pTag, "Start Preflight")
+	r := &PreflightReport{}
+	c := a.Config()
+
+	r.add("config", c.validate(a.customFS() == nil), "")
+
+	// Build a new ViewEngine to get the errors of the shared templates it skipped.
+	v, errs := a.newViewEngine(c)
+	for _, err := range errs {
+		r.add("shared template", err, "")
+	}
+	for _, name := range sortedTemplateNames(v.SharedTemplates) {
+		r.add("shared template "+name, nil, "")
+	}
+
+	views, err := v.listViews(c)
+	if err != nil {
+		r.add("views", err, "")
+	}
+	for _, rel := range views {
+		_, err = v.parseView(rel, c.RootDir+"/"+rel, "")
+		r.add("view "+rel, err, "")
+	}
+
+	binders := a.Binders()
+	keys := make([]string, 0, len(binders))
+	for key := range binders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b := binders[key]
+		name := "binder " + key
+		switch {
+		case b.Ctrl == nil:
+			r.add(name, fmt.Errorf("no Controller set"), "")
+		case b.View == "":
+			r.add(name, nil, "no View declared, checked at request time")
+		default:
+			_, err := v.parseView(b.View, c.RootDir+"/"+b.View, b.SharedTemplate)
+			r.add(name, err, b.View)
+		}
+	}
+
+	if !opts.SkipRedis {
+		r.add("redis "+c.RedisAddress, pingRedis(c.RedisAddress), "")
+	}
+
+	dbg.I(pTag, "End Preflight - %d checks, %d failed", len(r.Checks), len(r.Failed()))
+	return r
+}
+
+// sortedTemplateNames returns the keys of the given template map in order.
+func sortedTemplateNames(m map[string]Template) (names []string) {
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// RunPreflight runs Preflight for the given App, prints the report to w and returns the exit code for the process
+// (0 if all checks passed, otherwise 1), e.g. os.Exit(webfw.RunPreflight(app, os.Stderr)) to block a deploy.
+func RunPreflight(a *App, w io.Writer) int {
+	r := Preflight(a)
+	r.Print(w)
+	if !r.OK() {
+		return 1
+	}
+	return 0
+}
+
+// pingRedis checks that Redis at the given address answers to PING.
+func pingRedis(address string) error {
+	conn, err := redis.Dial("tcp", address,
+		redis.DialConnectTimeout(PreflightTimeout),
+		redis.DialReadTimeout(PreflightTimeout),
+		redis.DialWriteTimeout(PreflightTimeout))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("PING")
+	return err
+}
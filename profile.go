@@ -0,0 +1,233 @@
+package webfw
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Compufreak345/dbg"
+)
+
+// Names of the built-in profiles, used as ServerConfig.Environment.
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// ErrorDetail levels determine how much about an error is shown to the client.
+const (
+	// ErrorDetailMessage only shows the client message (or the status text).
+	ErrorDetailMessage = "message"
+	// ErrorDetailFull additionally shows the error source & the error itself.
+	ErrorDetailFull = "full"
+)
+
+// AccessLog formats determine how LoggingHandler logs requests.
+const (
+	// AccessLogPath logs method, path & duration.
+	AccessLogPath = "path"
+	// AccessLogURL logs method, the full URL including the query & duration.
+	AccessLogURL = "url"
+	// AccessLogCombined logs like the Apache combined log format, followed by the duration.
+	AccessLogCombined = "combined"
+)
+
+// Profile contains the settings that depend on the environment the server runs in.
+type Profile struct {
+	Name           string
+	CacheTemplates bool
+	// WatchTemplates caches templates but evicts them as soon as their files change.
+	WatchTemplates  bool
+	CacheFiles      bool
+	ErrorDetail     string
+	AccessLogFormat string
+	// SecurityHeaders are set on every response handled by WrapWithInit or MvcHandler - other handlers
+	// not wrapped by WrapWithInit (e.g. through InitHandler) have to set them using App.Profile.
+	SecurityHeaders map[string]string
+}
+
+// ProfileOverrides overrides single settings of the Profile chosen by ServerConfig.Environment.
+// Nil values keep the setting of the profile, a SecurityHeaders entry with an empty value removes the header.
+type ProfileOverrides struct {
+	CacheTemplates  *bool             `json:"CacheTemplates" yaml:"CacheTemplates" toml:"CacheTemplates"`
+	WatchTemplates  *bool             `json:"WatchTemplates" yaml:"WatchTemplates" toml:"WatchTemplates"`
+	CacheFiles      *bool             `json:"CacheFiles" yaml:"CacheFiles" toml:"CacheFiles"`
+	ErrorDetail     *string           `json:"ErrorDetail" yaml:"ErrorDetail" toml:"ErrorDetail"`
+	AccessLogFormat *string           `json:"AccessLogFormat" yaml:"AccessLogFormat" toml:"AccessLogFormat"`
+	SecurityHeaders map[string]string `json:"SecurityHeaders" yaml:"SecurityHeaders" toml:"SecurityHeaders"`
+}
+
+var profiles = struct {
+	sync.RWMutex
+	m map[string]Profile
+}{m: map[string]Profile{
+	EnvDevelopment: {
+		Name:            EnvDevelopment,
+		WatchTemplates:  true,
+		ErrorDetail:     ErrorDetailFull,
+		AccessLogFormat: AccessLogURL,
+		SecurityHeaders: map[string]string{
+			"X-Content-Type-Options": "nosniff",
+		},
+	},
+	EnvStaging: {
+		Name:            EnvStaging,
+		CacheTemplates:  true,
+		CacheFiles:      true,
+		ErrorDetail:     ErrorDetailMessage,
+		AccessLogFormat: AccessLogCombined,
+		SecurityHeaders: map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "SAMEORIGIN",
+			"Referrer-Policy":        "strict-origin-when-cross-origin",
+		},
+	},
+	EnvProduction: {
+		Name:            EnvProduction,
+		CacheTemplates:  true,
+		CacheFiles:      true,
+		ErrorDetail:     ErrorDetailMessage,
+		AccessLogFormat: AccessLogCombined,
+		SecurityHeaders: map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "SAMEORIGIN",
+			"Referrer-Policy":           "strict-origin-when-cross-origin",
+			"Strict-Transport-Security": "max-age=31536000",
+		},
+	},
+}}
+
+// RegisterProfile adds or replaces the Profile with the name p.Name, usable as ServerConfig.Environment.
+func RegisterProfile(p Profile) {
+	profiles.Lock()
+	profiles.m[p.Name] = p
+	profiles.Unlock()
+}
+
+// getProfile returns a copy of the registered profile with the given name.
+func getProfile(name string) (p Profile, ok bool) {
+	profiles.RLock()
+	p, ok = profiles.m[name]
+	profiles.RUnlock()
+	headers := make(map[string]string, len(p.SecurityHeaders))
+	for k, v := range p.SecurityHeaders {
+		headers[k] = v
+	}
+	p.SecurityHeaders = headers
+	return
+}
+
+// profileNames returns the names of all registered profiles.
+func profileNames() (names []string) {
+	profiles.RLock()
+	for name := range profiles.m {
+		names = append(names, name)
+	}
+	profiles.RUnlock()
+	sort.Strings(names)
+	return
+}
+
+// Profile returns the Profile for the Environment of the ServerConfig with the ProfileOverrides applied.
+// If no Environment is set, dbg.Develop chooses between development and production.
+// An unknown Environment falls back to production (Validate reports it).
+// It is computed on every call - handlers use App.Profile, computed once per ServerConfig.
+func (c *ServerConfig) Profile() *Profile {
+	p, _ := c.profile()
+	return p
+}
+
+// profile is Profile, known is false if the Environment is unknown.
+func (c *ServerConfig) profile() (pp *Profile, known bool) {
+	env := c.Environment
+	if env == "" {
+		env = EnvProduction
+		if dbg.Develop {
+			env = EnvDevelopment
+		}
+	}
+	p, known := getProfile(env)
+	if !known {
+		p, _ = getProfile(EnvProduction)
+	}
+	if o := c.ProfileOverrides; o != nil {
+		if o.CacheTemplates != nil {
+			p.CacheTemplates = *o.CacheTemplates
+		}
+		if o.WatchTemplates != nil {
+			p.WatchTemplates = *o.WatchTemplates
+		}
+		if o.CacheFiles != nil {
+			p.CacheFiles = *o.CacheFiles
+		}
+		if o.ErrorDetail != nil {
+			p.ErrorDetail = *o.ErrorDetail
+		}
+		if o.AccessLogFormat != nil {
+			p.AccessLogFormat = *o.AccessLogFormat
+		}
+		for k, v := range o.SecurityHeaders {
+			if v == "" {
+				delete(p.SecurityHeaders, k)
+			} else {
+				p.SecurityHeaders[k] = v
+			}
+		}
+	}
+	return &p, known
+}
+
+// Profile returns the Profile of the current ServerConfig of the App, computed once per ServerConfig.
+// The Profile is shared, do not change it. Do not change the ServerConfig in place either -
+// activate a changed copy using SetConfig or ReloadConfig.
+func (a *App) Profile() *Profile {
+	c := a.Config()
+	a.configMutex.RLock()
+	p, pc := a.profile, a.profileOf
+	a.configMutex.RUnlock()
+	if p != nil && pc == c {
+		return p
+	}
+	p, known := c.profile()
+	if !known {
+		dbg.W(cfTag, "Unknown Environment %q - using production profile", c.Environment)
+	}
+	a.configMutex.Lock()
+	if *a.config == c {
+		a.profile, a.profileOf = p, c
+	}
+	a.configMutex.Unlock()
+	return p
+}
+
+// setSecurityHeaders sets the SecurityHeaders of the Profile of the App on the response.
+func (a *App) setSecurityHeaders(w http.ResponseWriter) {
+	for k, v := range a.Profile().SecurityHeaders {
+		w.Header().Set(k, v)
+	}
+}
+
+// validateProfile checks the Environment & ProfileOverrides of the ServerConfig.
+func (c *ServerConfig) validateProfile() (errs ConfigErrors) {
+	if c.Environment != "" {
+		if _, ok := getProfile(c.Environment); !ok {
+			errs = append(errs, fmt.Errorf("Environment : unknown profile %q, known are %s", c.Environment, strings.Join(profileNames(), ", ")))
+		}
+	}
+	if o := c.ProfileOverrides; o != nil {
+		if o.ErrorDetail != nil && *o.ErrorDetail != ErrorDetailMessage && *o.ErrorDetail != ErrorDetailFull {
+			errs = append(errs, fmt.Errorf("ProfileOverrides.ErrorDetail : %q must be %q or %q", *o.ErrorDetail, ErrorDetailMessage, ErrorDetailFull))
+		}
+		if o.AccessLogFormat != nil {
+			switch *o.AccessLogFormat {
+			case AccessLogPath, AccessLogURL, AccessLogCombined:
+			default:
+				errs = append(errs, fmt.Errorf("ProfileOverrides.AccessLogFormat : %q must be %q, %q or %q", *o.AccessLogFormat, AccessLogPath, AccessLogURL, AccessLogCombined))
+			}
+		}
+	}
+	return
+}
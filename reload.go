@@ -0,0 +1,181 @@
+package webfw
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Compufreak345/alice"
+	"github.com/Compufreak345/dbg"
+	"golang.org/x/net/context"
+)
+
+const rTag = dbg.Tag("webfw/reload.go")
+
+// ConfigChangeFunc is called after the ServerConfig was swapped & one of the fields it subscribed to changed.
+type ConfigChangeFunc func(old *ServerConfig, new *ServerConfig)
+
+var configSubscribers = configSubscriberMap{m: make(map[string][]ConfigChangeFunc)}
+
+// init subscribes the SessionStore of the default App to changes of the RedisAddress.
+func init() {
+	defaultApp.OnConfigChange("RedisAddress", defaultApp.resetSessionStore)
+}
+
+// OnConfigChange registers fn to be called whenever the ServerConfig field with the given name
+// (e.g. "RedisAddress", "MaxResponseTime" or "TimeConfig") changes.
+func (a *App) OnConfigChange(field string, fn ConfigChangeFunc) {
+	if _, ok := reflect.TypeOf(ServerConfig{}).FieldByName(field); !ok {
+		panic(fmt.Sprintf("webfw: OnConfigChange for unknown ServerConfig field %q", field))
+	}
+	a.subscribers.Lock()
+	a.subscribers.m[field] = append(a.subscribers.m[field], fn)
+	a.subscribers.Unlock()
+}
+
+// ReloadConfig validates the given ServerConfig, builds a new ViewEngine for it and atomically swaps both.
+// Subscribers of changed fields are notified afterwards. On error, the old config stays active.
+// It returns the names of the fields that changed.
+func (a *App) ReloadConfig(c *ServerConfig) (changed []string, err error) {
+	dbg.I(rTag, "Start ReloadConfig")
+	if err = c.validate(a.customFS() == nil); err != nil {
+		dbg.W(rTag, "End ReloadConfig - new config is invalid : %v", err)
+		return
+	}
+	// A precompiled App also precompiles the new ViewEngine.
+	v, errs := a.newViewEngine(c)
+	if len(errs) != 0 {
+		v.Close()
+		err = ConfigErrors(errs)
+		dbg.W(rTag, "End ReloadConfig - could not build ViewEngine : %v", err)
+		return
+	}
+	changed = a.swapConfig(c, v)
+	dbg.I(rTag, "End ReloadConfig - changed fields : %v", changed)
+	return
+}
+
+// ReloadConfigFromFile loads the ServerConfig from the given file (see LoadServerConfig) and activates it using ReloadConfig.
+func (a *App) ReloadConfigFromFile(path string) (changed []string, err error) {
+	c, err := LoadServerConfig(path)
+	if err != nil {
+		return
+	}
+	return a.ReloadConfig(c)
+}
+
+// WatchConfigSignal reloads the ServerConfig from the given file whenever the process receives one of the given signals
+// (SIGHUP if none are given). Call the returned function to stop watching.
+func (a *App) WatchConfigSignal(path string, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				dbg.I(rTag, "Received %v - reloading config from %s", sig, path)
+				if _, err := a.ReloadConfigFromFile(path); err != nil {
+					dbg.E(rTag, "Reloading config from %s failed, keeping old config : %v", path, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// GetReloadConfigHandler returns an alice.CtxHandler reloading the ServerConfig from the given file.
+// It answers with the changed fields or with all problems of the new config. Protect it like any other admin handler.
+func (a *App) GetReloadConfigHandler(path string) alice.CtxHandler {
+	return alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(405), 405)
+			return
+		}
+		changed, err := a.ReloadConfigFromFile(path)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err != nil {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "Config not reloaded :", err)
+			return
+		}
+		fmt.Fprintln(w, "Config reloaded, changed fields :", strings.Join(changed, ", "))
+	})
+}
+
+// swapConfig activates the given ServerConfig & ViewEngine and notifies the subscribers of the changed fields.
+func (a *App) swapConfig(c *ServerConfig, v *ViewEngine) (changed []string) {
+	a.configMutex.Lock()
+	old := *a.config
+	oldViews := *a.views
+	*a.config = c
+	*a.views = v
+	a.configMutex.Unlock()
+	// Computes the Profile now instead of in the next request.
+	a.Profile()
+	if oldViews != nil && oldViews != v {
+		oldViews.Close()
+	}
+
+	if old == nil {
+		return
+	}
+	changed = changedConfigFields(old, c)
+	a.subscribers.Lock()
+	var fns []ConfigChangeFunc
+	for _, field := range changed {
+		fns = append(fns, a.subscribers.m[field]...)
+	}
+	a.subscribers.Unlock()
+	for _, fn := range fns {
+		fn(old, c)
+	}
+	return
+}
+
+// changedConfigFields returns the names of all fields that differ between the given configs.
+func changedConfigFields(old *ServerConfig, new *ServerConfig) (changed []string) {
+	ov := reflect.ValueOf(*old)
+	nv := reflect.ValueOf(*new)
+	for i := 0; i < ov.NumField(); i++ {
+		name := ov.Type().Field(i).Name
+		if name == "TimeConfig" {
+			if !timeConfigEqual(old.TimeConfig, new.TimeConfig) {
+				changed = append(changed, name)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return
+}
+
+// timeConfigEqual compares two TimeConfigs, treating locations with the same name as equal.
+func timeConfigEqual(a *TimeConfig, b *TimeConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.LongTimeFormatString == b.LongTimeFormatString &&
+		a.ShortTimeFormatString == b.ShortTimeFormatString &&
+		a.FileTimeFormatString == b.FileTimeFormatString &&
+		a.TimeLocation.String() == b.TimeLocation.String()
+}
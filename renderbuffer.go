@@ -0,0 +1,70 @@
+package webfw
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity up to which render buffers are reused.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// putBuffer returns b to the pool - very large buffers are dropped to free their memory.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(b)
+	}
+}
+
+// renderFlusher writes the rendered output to the client when a streaming template calls Flush (see ViewData.Stream).
+// The status & headers are sent with the first Flush.
+type renderFlusher struct {
+	w         http.ResponseWriter
+	buf       *bytes.Buffer
+	status    int
+	committed bool
+}
+
+// commit sends the status & headers if not yet done.
+func (f *renderFlusher) commit() {
+	if f.committed {
+		return
+	}
+	f.committed = true
+	if f.w.Header().Get("Content-Type") == "" {
+		f.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	f.w.WriteHeader(f.status)
+}
+
+// Flush writes the output rendered so far to the client.
+func (f *renderFlusher) Flush() error {
+	f.commit()
+	_, err := f.w.Write(f.buf.Bytes())
+	f.buf.Reset()
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return err
+}
+
+// writeBuffered sends the status, headers & the complete rendered output in b.
+func writeBuffered(w http.ResponseWriter, status int, b *bytes.Buffer) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	w.WriteHeader(status)
+	_, err := w.Write(b.Bytes())
+	return err
+}
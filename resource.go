@@ -0,0 +1,146 @@
+package webfw
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// MethodOverrideField is the form field HTML forms (which can only send GET & POST) use to send PUT, PATCH or DELETE
+// requests to a Router, e.g. <input type="hidden" name="_method" value="DELETE"> - only in forms sent as
+// application/x-www-form-urlencoded (the default enctype), not as multipart/form-data.
+// The header MethodOverrideHeader does the same for clients that can not send these methods.
+const (
+	MethodOverrideField  = "_method"
+	MethodOverrideHeader = "X-HTTP-Method-Override"
+)
+
+// ResourceController handles the actions of a resource, e.g. the trips of a user. Register it using Router.Resource.
+// id is the path parameter "id" of the request. Embed ResourceBase to only implement some of the actions.
+//
+// Create, Update & Delete usually answer with a Redirect and Status 303 (see ViewData.Status), so no view is needed.
+type ResourceController interface {
+	// Index lists the resources - GET /trips
+	Index(ctx context.Context, r *http.Request) (vd ViewData, vPath string, vSharedTemplate string, err error)
+	// Show shows a single resource - GET /trips/:id
+	Show(ctx context.Context, r *http.Request, id string) (vd ViewData, vPath string, vSharedTemplate string, err error)
+	// New shows the form for a new resource - GET /trips/new
+	New(ctx context.Context, r *http.Request) (vd ViewData, vPath string, vSharedTemplate string, err error)
+	// Create creates a resource from the posted form - POST /trips
+	Create(ctx context.Context, r *http.Request) (vd ViewData, vPath string, vSharedTemplate string, err error)
+	// Edit shows the form to change a resource - GET /trips/:id/edit
+	Edit(ctx context.Context, r *http.Request, id string) (vd ViewData, vPath string, vSharedTemplate string, err error)
+	// Update changes a resource - PUT or PATCH /trips/:id
+	Update(ctx context.Context, r *http.Request, id string) (vd ViewData, vPath string, vSharedTemplate string, err error)
+	// Delete deletes a resource - DELETE /trips/:id
+	Delete(ctx context.Context, r *http.Request, id string) (vd ViewData, vPath string, vSharedTemplate string, err error)
+}
+
+// ResourceBase implements all actions of a ResourceController with a 404 error page.
+type ResourceBase struct{}
+
+// notFound returns the ViewData of an action not implemented by a ResourceController.
+func (ResourceBase) notFound() (vd ViewData, vPath string, vSharedTemplate string, err error) {
+	return ViewData{ErrorType: 404, ErrorMessage: http.StatusText(404), ErrorSource: "webfw/resource.go"}, "", "", nil
+}
+
+func (b ResourceBase) Index(ctx context.Context, r *http.Request) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+func (b ResourceBase) Show(ctx context.Context, r *http.Request, id string) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+func (b ResourceBase) New(ctx context.Context, r *http.Request) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+func (b ResourceBase) Create(ctx context.Context, r *http.Request) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+func (b ResourceBase) Edit(ctx context.Context, r *http.Request, id string) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+func (b ResourceBase) Update(ctx context.Context, r *http.Request, id string) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+func (b ResourceBase) Delete(ctx context.Context, r *http.Request, id string) (ViewData, string, string, error) {
+	return b.notFound()
+}
+
+// Resource registers an MVCBinder for every action of the ResourceController & binds it to its route below the
+// given pattern. The binder keys are name followed by the action, so links can be built using URLFor :
+//
+//	GET    /trips            name.index   URLFor("trips.index")
+//	GET    /trips/new        name.new
+//	POST   /trips            name.create
+//	GET    /trips/:id        name.show    URLFor("trips.show", "id", trip.Id)
+//	GET    /trips/:id/edit   name.edit
+//	PUT    /trips/:id        name.update  (PATCH too)
+//	DELETE /trips/:id        name.delete
+//
+// HTML forms can send PUT, PATCH & DELETE as POST using MethodOverrideField. To set further options like Cache,
+// change the registered MVCBinders using App.Binder & App.SetBinder.
+func (rt *Router) Resource(pattern string, name string, rc ResourceController) *Router {
+	base := strings.TrimSuffix(pattern, "/")
+	root := base
+	if root == "" {
+		root = "/"
+	}
+	withID := func(action func(ctx context.Context, r *http.Request, id string) (ViewData, string, string, error)) ControllerFunc {
+		return func(ctx context.Context, r *http.Request) (ViewData, string, string, error) {
+			return action(ctx, r, GetPathParams(ctx).Get("id"))
+		}
+	}
+	actions := []struct {
+		methods []string
+		pattern string
+		action  string
+		ctrl    Controller
+	}{
+		{[]string{"GET"}, root, "index", ControllerFunc(rc.Index)},
+		{[]string{"GET"}, base + "/new", "new", ControllerFunc(rc.New)},
+		{[]string{"POST"}, root, "create", ControllerFunc(rc.Create)},
+		{[]string{"GET"}, base + "/:id", "show", withID(rc.Show)},
+		{[]string{"GET"}, base + "/:id/edit", "edit", withID(rc.Edit)},
+		{[]string{"PUT", "PATCH"}, base + "/:id", "update", withID(rc.Update)},
+		{[]string{"DELETE"}, base + "/:id", "delete", withID(rc.Delete)},
+	}
+	for _, a := range actions {
+		key := name + "." + a.action
+		rt.app.SetBinder(key, MVCBinder{Ctrl: a.ctrl})
+		for _, method := range a.methods {
+			rt.Bind(method, a.pattern, key)
+		}
+	}
+	return rt
+}
+
+// overrideMethod returns r with the method requested by MethodOverrideHeader or MethodOverrideField
+// if r is a POST request asking for PUT, PATCH or DELETE. The form field is only looked for in
+// application/x-www-form-urlencoded bodies, so no multipart body is parsed before the route is known.
+func overrideMethod(r *http.Request) *http.Request {
+	if r.Method != "POST" {
+		return r
+	}
+	method := r.Header.Get(MethodOverrideHeader)
+	if method == "" {
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/x-www-form-urlencoded" {
+			method = r.PostFormValue(MethodOverrideField)
+		}
+	}
+	switch method = strings.ToUpper(method); method {
+	case "PUT", "PATCH", "DELETE":
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.Method = method
+		return r2
+	}
+	return r
+}
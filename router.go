@@ -0,0 +1,309 @@
+package webfw
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Compufreak345/alice"
+	"github.com/Compufreak345/dbg"
+	"golang.org/x/net/context"
+)
+
+const rtTag = dbg.Tag("webfw/router.go")
+
+// Router maps request methods & path patterns to MVCBinders or other handlers of an App.
+// Patterns consist of segments separated by "/" : static segments, parameters like ":id" matching one segment and
+// a trailing catch-all like "*file" matching the rest of the path, e.g. "/trips/:id" or "/downloads/*file".
+// The values of the parameters are put into the context, see GetPathParams.
+// Patterns are relative to ServerConfig.SubDir - with SubDir "/alpha", "/trips/:id" matches "/alpha/trips/12".
+// If several patterns match, static segments win over parameters and parameters over catch-alls.
+//
+// Use the Router as final handler of the alice chain - InitHandler starts a new context, so parameters
+// put into the context before it would be lost.
+type Router struct {
+	app    *App
+	mutex  sync.RWMutex
+	routes []*route
+	// NotFound handles requests no pattern matches - a 404 error page if nil.
+	NotFound alice.CtxHandler
+	// ViewDataPolishFunc is passed to MvcHandler for the routes added by Bind.
+	ViewDataPolishFunc func(*ViewData, context.Context, *http.Request, string) string
+}
+
+// route is a pattern of a Router with its method & handler.
+type route struct {
+	method    string
+	pattern   string
+	segments  []routeSegment
+	binderKey string
+	handler   alice.CtxHandler
+}
+
+// routeSegment is a static segment or the name of a parameter of a route pattern.
+type routeSegment struct {
+	kind  int
+	value string
+}
+
+// Kinds of routeSegments, in the order they are preferred when several routes match.
+const (
+	staticSegment = iota
+	paramSegment
+	catchAllSegment
+)
+
+// pathParamsKey is the context key of the PathParams.
+type pathParamsKey struct{}
+
+// PathParams are the values of the parameters of the route pattern matching a request by name.
+type PathParams map[string]string
+
+// GetPathParams returns the PathParams put into the context by the Router - empty if there are none.
+func GetPathParams(ctx context.Context) PathParams {
+	if ctx != nil {
+		if p, ok := ctx.Value(pathParamsKey{}).(PathParams); ok {
+			return p
+		}
+	}
+	return PathParams{}
+}
+
+// Get returns the value of the parameter with the given name or "".
+func (p PathParams) Get(name string) string {
+	return p[name]
+}
+
+// Int64 returns the value of the parameter with the given name as int64.
+func (p PathParams) Int64(name string) (int64, error) {
+	v, ok := p[name]
+	if !ok {
+		return 0, fmt.Errorf("path parameter %q not found", name)
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("path parameter %q : %q is no integer", name, v)
+	}
+	return i, nil
+}
+
+// Int returns the value of the parameter with the given name as int.
+func (p PathParams) Int(name string) (int, error) {
+	i, err := p.Int64(name)
+	if err == nil && int64(int(i)) != i {
+		return 0, fmt.Errorf("path parameter %q : %d is out of range", name, i)
+	}
+	return int(i), err
+}
+
+// NewRouter returns a new Router for the App. Its routes are used by URLFor.
+func (a *App) NewRouter() *Router {
+	rt := &Router{app: a}
+	a.routers.Lock()
+	a.routers.l = append(a.routers.l, rt)
+	a.routers.Unlock()
+	return rt
+}
+
+// Bind lets the MVCBinder with the given binderKey handle requests with the given method matching the pattern.
+// It panics if the pattern is invalid or already bound for the method, like http.ServeMux.
+func (rt *Router) Bind(method string, pattern string, binderKey string) *Router {
+	rt.add(&route{method: method, pattern: pattern, binderKey: binderKey,
+		handler: rt.app.GetMvcHandler(binderKey, func(vd *ViewData, ctx context.Context, r *http.Request, vPath string) string {
+			if rt.ViewDataPolishFunc != nil {
+				return rt.ViewDataPolishFunc(vd, ctx, r, vPath)
+			}
+			return vPath
+		})})
+	return rt
+}
+
+// Handle lets h handle requests with the given method matching the pattern, e.g. a GetProvideFolderContentHandler.
+// It panics if the pattern is invalid or already bound for the method, like http.ServeMux.
+func (rt *Router) Handle(method string, pattern string, h alice.CtxHandler) *Router {
+	rt.add(&route{method: method, pattern: pattern, handler: h})
+	return rt
+}
+
+// add parses the pattern of the route & adds it.
+func (rt *Router) add(rte *route) {
+	segments, err := parseRoutePattern(rte.pattern)
+	if err != nil {
+		panic(fmt.Sprintf("webfw: Router : %v", err))
+	}
+	rte.method = strings.ToUpper(rte.method)
+	rte.segments = segments
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	for _, other := range rt.routes {
+		if other.method == rte.method && sameSegments(other.segments, segments) {
+			panic(fmt.Sprintf("webfw: Router : %s %s conflicts with %s %s", rte.method, rte.pattern, other.method, other.pattern))
+		}
+	}
+	rt.routes = append(rt.routes, rte)
+}
+
+// parseRoutePattern splits the given pattern into its segments.
+func parseRoutePattern(pattern string) (segments []routeSegment, err error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with \"/\"", pattern)
+	}
+	names := make(map[string]bool)
+	parts := splitPath(pattern)
+	for i, part := range parts {
+		s := routeSegment{kind: staticSegment, value: part}
+		switch part[0] {
+		case ':':
+			s = routeSegment{kind: paramSegment, value: part[1:]}
+		case '*':
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("pattern %q : catch-all %q must be the last segment", pattern, part)
+			}
+			s = routeSegment{kind: catchAllSegment, value: part[1:]}
+		}
+		if s.kind != staticSegment {
+			if s.value == "" {
+				return nil, fmt.Errorf("pattern %q : parameter without name", pattern)
+			}
+			if names[s.value] {
+				return nil, fmt.Errorf("pattern %q : duplicate parameter %q", pattern, s.value)
+			}
+			names[s.value] = true
+		}
+		segments = append(segments, s)
+	}
+	return
+}
+
+// splitPath returns the non-empty segments of the given path.
+func splitPath(p string) (parts []string) {
+	for _, part := range strings.Split(p, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return
+}
+
+// sameSegments returns whether the patterns with the given segments match the same paths.
+func sameSegments(a []routeSegment, b []routeSegment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].kind != b[i].kind || (a[i].kind == staticSegment && a[i].value != b[i].value) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the PathParams if the route matches the given (escaped) path segments.
+func (rte *route) match(parts []string) (params PathParams, ok bool) {
+	params = make(PathParams)
+	for i, s := range rte.segments {
+		if s.kind == catchAllSegment {
+			rest, err := url.PathUnescape(strings.Join(parts[i:], "/"))
+			if err != nil {
+				return nil, false
+			}
+			params[s.value] = rest
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		part, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return nil, false
+		}
+		if s.kind == paramSegment {
+			params[s.value] = part
+		} else if part != s.value {
+			return nil, false
+		}
+	}
+	return params, len(parts) == len(rte.segments)
+}
+
+// moreSpecific returns whether rte is preferred over other if both match.
+func (rte *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(rte.segments) && i < len(other.segments); i++ {
+		if rte.segments[i].kind != other.segments[i].kind {
+			return rte.segments[i].kind < other.segments[i].kind
+		}
+	}
+	return len(rte.segments) > len(other.segments)
+}
+
+// ServeHTTP lets the handler of the best route matching the method & path of r handle it.
+// If a route matches the path, but not the method, it answers 405 with an Allow header.
+// POST requests may ask for another method, see MethodOverrideField.
+func (rt *Router) ServeHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	r = overrideMethod(r)
+	p := r.URL.EscapedPath()
+	if subDir := rt.app.Config().SubDir; subDir != "" {
+		if p != subDir && !strings.HasPrefix(p, subDir+"/") {
+			rt.notFound(ctx, w, r)
+			return
+		}
+		p = strings.TrimPrefix(p, subDir)
+	}
+	parts := splitPath(p)
+
+	var best *route
+	var bestParams PathParams
+	allowed := make(map[string]bool)
+	rt.mutex.RLock()
+	for _, rte := range rt.routes {
+		params, ok := rte.match(parts)
+		if !ok {
+			continue
+		}
+		allowed[rte.method] = true
+		if rte.method != r.Method && !(r.Method == "HEAD" && rte.method == "GET") {
+			continue
+		}
+		// A HEAD route wins over the GET route of the same pattern.
+		if best == nil || rte.moreSpecific(best) || (rte.method == r.Method && sameSegments(rte.segments, best.segments)) {
+			best, bestParams = rte, params
+		}
+	}
+	rt.mutex.RUnlock()
+
+	if best == nil {
+		if len(allowed) == 0 {
+			rt.notFound(ctx, w, r)
+			return
+		}
+		if allowed["GET"] {
+			allowed["HEAD"] = true
+		}
+		methods := make([]string, 0, len(allowed))
+		for m := range allowed {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		dbg.D(rtTag, "Method %s not allowed for %s", r.Method, r.URL.Path)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		rt.app.DirectShowError_NoVD(ctx, w, r, nil, http.StatusText(405), 405)
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	best.handler.ServeHTTP(context.WithValue(ctx, pathParamsKey{}, bestParams), w, r)
+}
+
+// notFound handles a request no route matches.
+func (rt *Router) notFound(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if rt.NotFound != nil {
+		rt.NotFound.ServeHTTP(ctx, w, r)
+		return
+	}
+	rt.app.DirectShowError_NoVD(ctx, w, r, nil, http.StatusText(404), 404)
+}
@@ -0,0 +1,132 @@
+package webfw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Compufreak345/alice"
+	"golang.org/x/net/context"
+)
+
+// routeTestHandler writes the given name followed by the sorted PathParams.
+func routeTestHandler(name string) alice.CtxHandler {
+	return alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		params := GetPathParams(ctx)
+		out := []string{name}
+		for k, v := range params {
+			out = append(out, k+"="+v)
+		}
+		sort.Strings(out[1:])
+		fmt.Fprint(w, strings.Join(out, " "))
+	})
+}
+
+func newRouteTestRouter(subDir string) *Router {
+	rt := NewApp(&ServerConfig{SubDir: subDir}).NewRouter()
+	rt.NotFound = alice.CtxHandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", 404)
+	})
+	rt.Handle("GET", "/trips", routeTestHandler("index")).
+		Handle("GET", "/trips/new", routeTestHandler("new")).
+		Handle("GET", "/trips/:id", routeTestHandler("show")).
+		Handle("put", "/trips/:id", routeTestHandler("update")).
+		Handle("GET", "/trips/:id/stops/:stop", routeTestHandler("stop")).
+		Handle("GET", "/files/*path", routeTestHandler("files")).
+		Handle("GET", "/head", routeTestHandler("get")).
+		Handle("HEAD", "/head", routeTestHandler("head"))
+	return rt
+}
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		method    string
+		path      string
+		form      string
+		subDir    string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{method: "GET", path: "/trips", wantBody: "index"},
+		{method: "GET", path: "/trips/", wantBody: "index"},
+		{method: "GET", path: "/trips/new", wantBody: "new"},
+		{method: "GET", path: "/trips/12", wantBody: "show id=12"},
+		{method: "GET", path: "/trips/a%2Fb", wantBody: "show id=a/b"},
+		{method: "GET", path: "/trips/12/stops/3", wantBody: "stop id=12 stop=3"},
+		{method: "PUT", path: "/trips/12", wantBody: "update id=12"},
+		{method: "POST", path: "/trips/12", form: MethodOverrideField + "=PUT", wantBody: "update id=12"},
+		{method: "GET", path: "/files/a/b%20c.txt", wantBody: "files path=a/b c.txt"},
+		{method: "GET", path: "/files", wantBody: "files path="},
+		{method: "HEAD", path: "/trips", wantBody: "index"},
+		{method: "HEAD", path: "/head", wantBody: "head"},
+		{method: "GET", path: "/head", wantBody: "get"},
+		{method: "GET", path: "/unknown", wantCode: 404},
+		{method: "GET", path: "/trips/12/stops", wantCode: 404},
+		{method: "DELETE", path: "/trips/12", wantCode: 405, wantAllow: "GET, HEAD, PUT"},
+		{method: "GET", path: "/alpha/trips/12", subDir: "/alpha", wantBody: "show id=12"},
+		{method: "GET", path: "/alpha", subDir: "/alpha", wantCode: 404},
+		{method: "GET", path: "/trips/12", subDir: "/alpha", wantCode: 404},
+		{method: "GET", path: "/alphabet/trips", subDir: "/alpha", wantCode: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.subDir+tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.form))
+			if tt.form != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			w := httptest.NewRecorder()
+			newRouteTestRouter(tt.subDir).ServeHTTP(context.Background(), w, r)
+
+			wantCode := tt.wantCode
+			if wantCode == 0 {
+				wantCode = 200
+			}
+			if w.Code != wantCode {
+				t.Fatalf("code = %d, want %d", w.Code, wantCode)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", allow, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestParseRoutePatternErrors(t *testing.T) {
+	for _, pattern := range []string{"trips", "/files/*path/more", "/trips/:", "/trips/*", "/trips/:id/stops/:id"} {
+		if _, err := parseRoutePattern(pattern); err == nil {
+			t.Errorf("parseRoutePattern(%q) returned no error", pattern)
+		}
+	}
+}
+
+func TestRouterConflictPanics(t *testing.T) {
+	rt := newRouteTestRouter("")
+	defer func() {
+		if recover() == nil {
+			t.Error("binding /trips/:name after /trips/:id did not panic")
+		}
+	}()
+	rt.Handle("GET", "/trips/:name", routeTestHandler("other"))
+}
+
+func TestPathParams(t *testing.T) {
+	p := PathParams{"id": "12", "big": "99999999999999999999", "name": "x"}
+	if i, err := p.Int("id"); err != nil || i != 12 {
+		t.Errorf("Int(id) = %d, %v", i, err)
+	}
+	for _, name := range []string{"big", "name", "missing"} {
+		if _, err := p.Int64(name); err == nil {
+			t.Errorf("Int64(%s) returned no error", name)
+		}
+	}
+	if got := GetPathParams(context.Background()).Get("id"); got != "" {
+		t.Errorf("GetPathParams without params : Get(id) = %q", got)
+	}
+}
@@ -3,11 +3,15 @@ package webfw
 import (
 	"path"
 	"runtime"
+	"sync"
 	"time"
 )
 
 var config *ServerConfig
 
+// configMutex guards config & V of the default App, as they may be swapped by ReloadConfig while requests are served.
+var configMutex = &sync.RWMutex{}
+
 // The configuration to set up a webfw-server.
 type ServerConfig struct {
 	RootDir         string
@@ -24,12 +28,32 @@ type ServerConfig struct {
 	GitLabPath   string
 	SmtpHost     string
 	SmtpPort     string
-	Environment  string
+	// SmtpUser & SmtpPassword authenticate the Mailer if SmtpUser is set.
+	SmtpUser     string
+	SmtpPassword string
+	// SmtpFrom is the sender address of mails without From, e.g. "ODL <noreply@opendriverslog.de>".
+	SmtpFrom string
+	// StaticDirs are the folders (relative to RootDir, e.g. "static") whose files are fingerprinted, see AssetManifest.
+	StaticDirs []string
+	// Environment chooses the Profile (e.g. "development", "staging" or "production")
+	Environment string
+	// ProfileOverrides overrides single settings of the Profile.
+	ProfileOverrides *ProfileOverrides
 }
 
 // NewServerConfig returns a new ServerConfig with some values.
 func NewServerConfig() *ServerConfig {
-	c := &ServerConfig{
+	c := defaultServerConfig()
+
+	_, filename, _, _ := runtime.Caller(1)
+	c.RootDir = path.Dir(filename)
+
+	return c
+}
+
+// defaultServerConfig returns the default values shared by NewServerConfig and LoadServerConfig.
+func defaultServerConfig() *ServerConfig {
+	return &ServerConfig{
 		MaxResponseTime: time.Second * 20,
 		TimeoutMessage:  "Your request timed out. Please try again. If this error reoccures, please contact us.",
 		TimeConfig:      GetDefaultTimeConfig(),
@@ -39,25 +63,16 @@ func NewServerConfig() *ServerConfig {
 		SmtpHost:        "mail.opendriverslog.de",
 		SmtpPort:        "587",
 	}
-
-	_, filename, _, _ := runtime.Caller(1)
-	c.RootDir = path.Dir(filename)
-
-	return c
 }
 
-// SetConfig sets the ServerConfig.
+// SetConfig sets the ServerConfig of the default App.
 func SetConfig(c *ServerConfig) {
-	config = c
-	V = NewViewEngine()
+	defaultApp.SetConfig(c)
 }
 
-// Config gets the ServerConfig.
+// Config gets the ServerConfig of the default App.
 func Config() *ServerConfig {
-	if config == nil {
-		config = NewServerConfig()
-	}
-	return config
+	return defaultApp.Config()
 }
 
 // TimeConfig determines how to print user-friendly date/timestamps.
@@ -0,0 +1,78 @@
+package webfw
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SetFS lets the App read views, shared templates and folder contents from the given fs.FS (e.g. an embed.FS)
+// instead of the disk. Names in fsys are relative to RootDir, e.g. "views/odl.html" or "views/shared/base.html".
+// Pass nil to read from disk again. The ViewEngine is rebuilt.
+func (a *App) SetFS(fsys fs.FS) {
+	a.configMutex.Lock()
+	a.fsys = fsys
+	a.configMutex.Unlock()
+	c := a.Config()
+	v, _ := a.newViewEngine(c)
+	a.swapConfig(c, v)
+}
+
+// FS returns the fs.FS the App reads its files from - os.DirFS(RootDir) if none was set using SetFS.
+func (a *App) FS() fs.FS {
+	a.configMutex.RLock()
+	fsys := a.fsys
+	a.configMutex.RUnlock()
+	return siteFS(a.Config(), fsys)
+}
+
+// customFS returns the fs.FS set using SetFS or nil.
+func (a *App) customFS() fs.FS {
+	a.configMutex.RLock()
+	defer a.configMutex.RUnlock()
+	return a.fsys
+}
+
+// NewViewEngineFS returns a new ViewEngine reading views & shared templates from the given fs.FS, see App.SetFS.
+// Close it when it is not used anymore.
+func NewViewEngineFS(fsys fs.FS) *ViewEngine {
+	e, _ := newViewEngineFor(Config(), fsys, defaultApp.engineViewOptions(), defaultApp.metrics)
+	return e
+}
+
+// siteFS returns fsys or, if nil, the disk below RootDir.
+func siteFS(c *ServerConfig, fsys fs.FS) fs.FS {
+	if fsys != nil {
+		return fsys
+	}
+	return os.DirFS(c.RootDir)
+}
+
+// fsName converts a path on disk (absolute below rootDir or relative to it) into a name valid for fs.FS.
+func fsName(rootDir string, p string) string {
+	p = filepath.ToSlash(p)
+	root := strings.TrimSuffix(filepath.ToSlash(rootDir), "/")
+	if root != "" && strings.HasPrefix(p, root+"/") {
+		p = p[len(root)+1:]
+	}
+	return path.Clean(strings.TrimPrefix(p, "/"))
+}
+
+// readFile reads the file at the given path from the fs.FS of the ViewEngine, or from disk if there is none.
+func (v *ViewEngine) readFile(p string) ([]byte, error) {
+	if v.fsys == nil {
+		return ioutil.ReadFile(p)
+	}
+	return fs.ReadFile(v.fsys, fsName(v.rootDir, p))
+}
+
+// readDir lists the directory at the given path from the fs.FS of the ViewEngine, or from disk if there is none.
+func (v *ViewEngine) readDir(dir string) ([]fs.DirEntry, error) {
+	if v.fsys == nil {
+		return os.ReadDir(dir)
+	}
+	return fs.ReadDir(v.fsys, fsName(v.rootDir, dir))
+}
@@ -0,0 +1,82 @@
+package webfw
+
+import (
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// statusWriter wraps a http.ResponseWriter, remembering the status code & the number of bytes written.
+// After a timeout, WrapWithInit & the handler still running write to it concurrently, so it is locked.
+type statusWriter struct {
+	http.ResponseWriter
+	mutex  sync.Mutex
+	status int
+	size   int
+}
+
+// statusWriterKey is the context key of the statusWriter of WrapWithInit.
+type statusWriterKey struct{}
+
+// requestStatusWriter returns the statusWriter WrapWithInit put into the context for w - or wraps w in a new one.
+// Sharing it, MvcHandler sees the status of the TimeoutMessage if WrapWithInit answered first.
+func requestStatusWriter(ctx context.Context, w http.ResponseWriter) *statusWriter {
+	if ctx != nil {
+		if sw, ok := ctx.Value(statusWriterKey{}).(*statusWriter); ok && (sw == w || sw.ResponseWriter == w) {
+			return sw
+		}
+	}
+	return newStatusWriter(w)
+}
+
+// newStatusWriter wraps the given http.ResponseWriter - if it already is a statusWriter, it is returned as is.
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	if sw, ok := w.(*statusWriter); ok {
+		return sw
+	}
+	return &statusWriter{ResponseWriter: w}
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.mutex.Lock()
+	if w.status == 0 {
+		w.status = status
+	}
+	w.mutex.Unlock()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	if w.status == 0 {
+		w.status = 200
+	}
+	w.mutex.Unlock()
+	n, err := w.ResponseWriter.Write(b)
+	w.mutex.Lock()
+	w.size += n
+	w.mutex.Unlock()
+	return n, err
+}
+
+// Status returns the status code sent, 200 if only the body was written and 0 if nothing was written yet.
+func (w *statusWriter) Status() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.status
+}
+
+// Size returns the number of bytes written.
+func (w *statusWriter) Size() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.size
+}
+
+// Flush flushes the underlying http.ResponseWriter if it supports it.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
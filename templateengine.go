@@ -0,0 +1,188 @@
+package webfw
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Template is a parsed view or shared template. *html/template.Template & *text/template.Template implement it.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// TemplateEngine parses the views & shared templates with the file extensions it is registered for,
+// see RegisterTemplateEngine.
+type TemplateEngine interface {
+	// ParseShared parses the source of the shared template with the given name.
+	ParseShared(name string, src []byte, o ViewOptions) (Template, error)
+	// ParseView parses the source of the view with the given name into the given shared templates (see Layout),
+	// which were parsed by the same TemplateEngine. The first of them is executed as the view, if there is one.
+	ParseView(name string, src []byte, layout []Template, o ViewOptions) (Template, error)
+	// HasTemplate reports whether t defines an executable template with the given name, see FragmentHeader.
+	HasTemplate(t Template, name string) bool
+}
+
+// The built-in TemplateEngines. HTMLTemplateEngine is used for all extensions without a registered TemplateEngine.
+var (
+	HTMLTemplateEngine TemplateEngine = htmlEngine{}
+	TextTemplateEngine TemplateEngine = textEngine{}
+)
+
+var templateEngines = struct {
+	sync.RWMutex
+	m map[string]TemplateEngine
+}{m: map[string]TemplateEngine{
+	".html": HTMLTemplateEngine,
+	".htm":  HTMLTemplateEngine,
+	".txt":  TextTemplateEngine,
+	// A CSV export has no front-matter, a leading "---" is data.
+	".csv": WithoutFrontMatter(TextTemplateEngine),
+}}
+
+// RegisterTemplateEngine sets the TemplateEngine parsing the views & shared templates with the given file extension,
+// e.g. ".txt". Register engines before the ViewEngine is created, e.g. before SetConfig.
+func RegisterTemplateEngine(ext string, e TemplateEngine) {
+	templateEngines.Lock()
+	templateEngines.m[strings.ToLower(ext)] = e
+	templateEngines.Unlock()
+}
+
+// templateEngineFor returns the TemplateEngine for the file at the given path.
+func templateEngineFor(path string) TemplateEngine {
+	templateEngines.RLock()
+	defer templateEngines.RUnlock()
+	if e, ok := templateEngines.m[strings.ToLower(filepath.Ext(path))]; ok {
+		return e
+	}
+	return HTMLTemplateEngine
+}
+
+// viewContentType returns the Content-Type for the view at the given path if it is not parsed by HTMLTemplateEngine.
+func viewContentType(path string) string {
+	if templateEngineFor(path) == HTMLTemplateEngine {
+		return ""
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(path)); ct != "" {
+		return ct
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// errNotSameEngine is returned if a view is parsed into a shared template of another TemplateEngine.
+func errNotSameEngine(engine string) error {
+	return fmt.Errorf("the shared templates of a view parsed by %s must be parsed by %s too - check their extensions", engine, engine)
+}
+
+// htmlEngine parses templates using html/template.
+type htmlEngine struct{}
+
+func (htmlEngine) ParseShared(name string, src []byte, o ViewOptions) (Template, error) {
+	t, err := o.apply(htmltemplate.New(name)).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (htmlEngine) ParseView(name string, src []byte, layout []Template, o ViewOptions) (Template, error) {
+	x := htmltemplate.New(name)
+	if len(layout) != 0 {
+		base, ok := layout[0].(*htmltemplate.Template)
+		if !ok {
+			return nil, errNotSameEngine("html/template")
+		}
+		var err error
+		if x, err = base.Clone(); err != nil {
+			return nil, err
+		}
+		for _, l := range layout[1:] {
+			partial, ok := l.(*htmltemplate.Template)
+			if !ok {
+				return nil, errNotSameEngine("html/template")
+			}
+			for _, pt := range partial.Templates() {
+				if pt.Tree == nil {
+					continue
+				}
+				// Copy the tree, as html/template modifies it when escaping on first execution.
+				if _, err = x.AddParseTree(pt.Name(), pt.Tree.Copy()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	t, err := o.apply(x).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (htmlEngine) HasTemplate(t Template, name string) bool {
+	ht, ok := t.(*htmltemplate.Template)
+	if !ok {
+		return false
+	}
+	f := ht.Lookup(name)
+	return f != nil && f.Tree != nil
+}
+
+// textEngine parses templates using text/template, e.g. for plain-text mails & CSV exports.
+type textEngine struct{}
+
+func (textEngine) ParseShared(name string, src []byte, o ViewOptions) (Template, error) {
+	t, err := o.applyText(texttemplate.New(name)).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (textEngine) ParseView(name string, src []byte, layout []Template, o ViewOptions) (Template, error) {
+	x := texttemplate.New(name)
+	if len(layout) != 0 {
+		base, ok := layout[0].(*texttemplate.Template)
+		if !ok {
+			return nil, errNotSameEngine("text/template")
+		}
+		var err error
+		if x, err = base.Clone(); err != nil {
+			return nil, err
+		}
+		for _, l := range layout[1:] {
+			partial, ok := l.(*texttemplate.Template)
+			if !ok {
+				return nil, errNotSameEngine("text/template")
+			}
+			for _, pt := range partial.Templates() {
+				if pt.Tree == nil {
+					continue
+				}
+				if _, err = x.AddParseTree(pt.Name(), pt.Tree.Copy()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	t, err := o.applyText(x).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (textEngine) HasTemplate(t Template, name string) bool {
+	tt, ok := t.(*texttemplate.Template)
+	if !ok {
+		return false
+	}
+	f := tt.Lookup(name)
+	return f != nil && f.Tree != nil
+}
@@ -0,0 +1,126 @@
+package webfw
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SnippetContext is the number of lines shown before & after the offending line of a TemplateError.
+var SnippetContext = 2
+
+// TemplateError describes a template file that could not be parsed.
+type TemplateError struct {
+	File    string
+	Line    int
+	Message string
+	// Snippet contains the offending line & the lines around it.
+	Snippet []SnippetLine
+	Err     error
+	// Warning is set for problems that do not stop the site from working, e.g. a view that could not be checked.
+	Warning bool
+}
+
+// SnippetLine is a single line of the source of a TemplateError.
+type SnippetLine struct {
+	Number    int
+	Text      string
+	Offending bool
+}
+
+func (e *TemplateError) Error() string {
+	prefix := ""
+	if e.Warning {
+		prefix = "warning : "
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s%s : %s", prefix, e.File, e.Message)
+	}
+	return fmt.Sprintf("%s%s:%d : %s", prefix, e.File, e.Line, e.Message)
+}
+
+// TemplateErrors contains every TemplateError found while precompiling.
+type TemplateErrors []*TemplateError
+
+func (e TemplateErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	failed := len(e.Failed())
+	summary := fmt.Sprintf("%d templates could not be parsed", failed)
+	switch warnings := len(e) - failed; {
+	case failed == 0:
+		summary = fmt.Sprintf("%d warnings", warnings)
+	case warnings != 0:
+		summary += fmt.Sprintf(", %d warnings", warnings)
+	}
+	return fmt.Sprintf("%s :\n\t%s", summary, strings.Join(msgs, "\n\t"))
+}
+
+// Failed returns the TemplateErrors that are not warnings.
+func (e TemplateErrors) Failed() (failed TemplateErrors) {
+	for _, te := range e {
+		if !te.Warning {
+			failed = append(failed, te)
+		}
+	}
+	return
+}
+
+// templateErrRegexp matches errors of text/template/parse like "template: name:12: unexpected EOF"
+// or "template: name:12:5: ...".
+var templateErrRegexp = regexp.MustCompile(`^template: [^:]*:(\d+):(?:\d+:)? ?(.*)$`)
+
+// newTemplateError converts the error returned while parsing the file at path with the given source into a TemplateError.
+// The template name in the error may differ from the file (e.g. when parsing into a shared template), so the
+// file is given explicitly.
+func newTemplateError(path string, src []byte, err error) *TemplateError {
+	te := &TemplateError{File: path, Message: err.Error(), Err: err}
+	m := templateErrRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return te
+	}
+	te.Line, _ = strconv.Atoi(m[1])
+	te.Message = m[2]
+
+	lines := strings.Split(string(src), "\n")
+	from := te.Line - SnippetContext
+	if from < 1 {
+		from = 1
+	}
+	to := te.Line + SnippetContext
+	if to > len(lines) {
+		to = len(lines)
+	}
+	for n := from; n <= to; n++ {
+		te.Snippet = append(te.Snippet, SnippetLine{
+			Number:    n,
+			Text:      strings.TrimRight(lines[n-1], "\r"),
+			Offending: n == te.Line,
+		})
+	}
+	return te
+}
+
+var templateErrorPage = template.Must(template.New("templateError").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Template error</title>
+<style>
+body{font-family:sans-serif;margin:2em}pre{background:#f6f6f6;padding:1em;overflow:auto}
+.offending{background:#fdd}.no{color:#999;display:inline-block;width:4em}
+</style></head><body>
+<h1>Template error</h1>
+{{range .}}<h2>{{.File}}{{if .Line}}:{{.Line}}{{end}}</h2>
+<p>{{.Message}}</p>
+{{if .Snippet}}<pre>{{range .Snippet}}<span{{if .Offending}} class="offending"{{end}}><span class="no">{{.Number}}</span>{{.Text}}</span>
+{{end}}</pre>{{end}}
+{{end}}</body></html>
+`))
+
+// writeTemplateErrorPage writes a HTML page showing the given TemplateErrors.
+func writeTemplateErrorPage(w io.Writer, errs TemplateErrors) error {
+	return templateErrorPage.Execute(w, errs)
+}
@@ -0,0 +1,76 @@
+package webfw
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// ViewDataOf is a ViewData with a Model of the concrete type T. Templates reach the fields & methods of the Model
+// directly as {[{.Model.Name}]} without C, and the compiler checks what controllers put into it.
+// All other fields & methods of the ViewData (e.g. {[{.Data}]} or {[{$.Flush}]}) work like before.
+type ViewDataOf[T any] struct {
+	ViewData
+	Model T
+}
+
+// typedViewData is implemented by ViewDataOf - see ViewData.typed.
+type typedViewData interface {
+	withViewData(vd ViewData) interface{}
+}
+
+// withViewData returns a copy of the ViewDataOf using the given ViewData - e.g. with the flusher set while rendering.
+func (vd ViewDataOf[T]) withViewData(base ViewData) interface{} {
+	vd.ViewData = base
+	return vd
+}
+
+// Untyped returns the ViewData, usable wherever a ViewData is expected (e.g. RenderViewHttpResp or Mail.Data).
+// Templates rendered with it still see the typed Model, serializing Renderers get it from Model.C().
+func (vd ViewDataOf[T]) Untyped() ViewData {
+	base := vd.ViewData
+	base.Model = typedModel[T]{model: vd.Model}
+	base.typed = vd
+	return base
+}
+
+// typedModel is the IModel of a ViewDataOf.
+type typedModel[T any] struct {
+	model T
+}
+
+// C returns the Model of the ViewDataOf.
+func (m typedModel[T]) C() interface{} {
+	return m.model
+}
+
+// templateData returns the value templates are executed with - the ViewDataOf if vd was created by Untyped.
+func (vd ViewData) templateData() interface{} {
+	if vd.typed != nil {
+		return vd.typed.withViewData(vd)
+	}
+	return vd
+}
+
+// ControllerOf is a Controller returning a ViewDataOf, register it as MVCBinder.Ctrl using AsController.
+type ControllerOf[T any] interface {
+	GetViewData(ctx context.Context, r *http.Request) (vd ViewDataOf[T], vPath string, vSharedTemplate string, err error)
+}
+
+// ControllerFuncOf lets an ordinary function be used as ControllerOf.
+type ControllerFuncOf[T any] func(ctx context.Context, r *http.Request) (vd ViewDataOf[T], vPath string, vSharedTemplate string, err error)
+
+// GetViewData calls f(ctx, r).
+func (f ControllerFuncOf[T]) GetViewData(ctx context.Context, r *http.Request) (vd ViewDataOf[T], vPath string, vSharedTemplate string, err error) {
+	return f(ctx, r)
+}
+
+// AsController returns a Controller for the given ControllerOf, e.g.
+//
+//	webfw.DefaultApp().SetBinder("trip", webfw.MVCBinder{Ctrl: webfw.AsController[Trip](TripController{})})
+func AsController[T any](c ControllerOf[T]) Controller {
+	return ControllerFunc(func(ctx context.Context, r *http.Request) (ViewData, string, string, error) {
+		vd, vPath, vSharedTemplate, err := c.GetViewData(ctx, r)
+		return vd.Untyped(), vPath, vSharedTemplate, err
+	})
+}
@@ -0,0 +1,170 @@
+package webfw
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// routerList contains the Routers of an App, searched by URLFor.
+type routerList struct {
+	sync.RWMutex
+	l []*Router
+}
+
+// URLFor returns the path of the route bound to the MVCBinder with the given binderKey (see Router.Bind),
+// prefixed with SubDir. params are pairs of parameter names & values, e.g.
+//
+//	a.URLFor("trip", "id", 12) // "/alpha/trips/12"
+//
+// If several routes are bound to the binder, the first one with exactly the given parameters is used,
+// preferring GET routes. It returns an error if no route is bound to the binder or no route has these parameters.
+func (a *App) URLFor(binderKey string, params ...interface{}) (string, error) {
+	p, err := a.routePath(binderKey, params)
+	if err != nil {
+		return "", err
+	}
+	return subDirURL(a.Config().SubDir, p), nil
+}
+
+// AbsoluteURLFor returns the URL of the route bound to the MVCBinder with the given binderKey like URLFor,
+// but prefixed with WebUrl - e.g. for links in mails.
+func (a *App) AbsoluteURLFor(binderKey string, params ...interface{}) (string, error) {
+	u, err := a.URLFor(binderKey, params...)
+	if err != nil {
+		return "", err
+	}
+	return absoluteURL(a.Config(), u)
+}
+
+// absoluteURL prefixes the given site-relative URL (including SubDir) with the WebUrl of the ServerConfig.
+func absoluteURL(c *ServerConfig, u string) (string, error) {
+	if c.WebUrl == "" {
+		return "", fmt.Errorf("can not build absolute URL for %s : WebUrl is not set", u)
+	}
+	base, err := url.Parse(c.WebUrl)
+	if err != nil {
+		return "", fmt.Errorf("can not build absolute URL for %s : %v", u, err)
+	}
+	// WebUrl may already contain the SubDir.
+	if c.SubDir != "" && strings.HasSuffix(strings.TrimSuffix(base.Path, "/"), c.SubDir) {
+		u = strings.TrimPrefix(u, c.SubDir)
+	}
+	return strings.TrimSuffix(c.WebUrl, "/") + u, nil
+}
+
+// routePath builds the path (without SubDir) of the route bound to binderKey from the given parameter pairs.
+func (a *App) routePath(binderKey string, params []interface{}) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("URLFor %s : odd number of parameters %d", binderKey, len(params))
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		name, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("URLFor %s : parameter name %v is no string", binderKey, params[i])
+		}
+		values[name] = fmt.Sprint(params[i+1])
+	}
+
+	var candidates []*route
+	a.routers.RLock()
+	for _, rt := range a.routers.l {
+		rt.mutex.RLock()
+		for _, rte := range rt.routes {
+			if rte.binderKey == binderKey && rte.binderKey != "" {
+				candidates = append(candidates, rte)
+			}
+		}
+		rt.mutex.RUnlock()
+	}
+	a.routers.RUnlock()
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("URLFor : no route bound to binder %q", binderKey)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].method == "GET" && candidates[j].method != "GET"
+	})
+	for _, rte := range candidates {
+		if rte.hasParams(values) {
+			return rte.build(values), nil
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("URLFor : no route of binder %q has the parameters [%s], %s needs [%s]", binderKey,
+		strings.Join(names, " "), candidates[0].pattern, strings.Join(candidates[0].paramNames(), " "))
+}
+
+// paramNames returns the names of the parameters of the route.
+func (rte *route) paramNames() (names []string) {
+	for _, s := range rte.segments {
+		if s.kind != staticSegment {
+			names = append(names, s.value)
+		}
+	}
+	return
+}
+
+// hasParams returns whether the route has exactly the parameters with the given names.
+func (rte *route) hasParams(values map[string]string) bool {
+	names := rte.paramNames()
+	if len(names) != len(values) {
+		return false
+	}
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// build returns the path of the route with the given parameter values, escaping them.
+func (rte *route) build(values map[string]string) string {
+	parts := make([]string, len(rte.segments))
+	for i, s := range rte.segments {
+		switch s.kind {
+		case staticSegment:
+			parts[i] = s.value
+		case paramSegment:
+			parts[i] = url.PathEscape(values[s.value])
+		case catchAllSegment:
+			rest := strings.Split(values[s.value], "/")
+			for j := range rest {
+				rest[j] = url.PathEscape(rest[j])
+			}
+			parts[i] = strings.Join(rest, "/")
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// urlForFuncs returns the template functions of the App :
+//
+//	urlFor "trip" "id" .ID      the path of the route of a binder, see URLFor
+//	absURLFor "trip" "id" .ID   the absolute URL of the route of a binder, see AbsoluteURLFor
+func (a *App) urlForFuncs() template.FuncMap {
+	return template.FuncMap{
+		"urlFor":    a.URLFor,
+		"absURLFor": a.AbsoluteURLFor,
+	}
+}
+
+// engineViewOptions returns the ViewOptions of the App with its template functions added - Funcs set using
+// SetViewOptions with the same name replace them.
+func (a *App) engineViewOptions() ViewOptions {
+	o := a.ViewOptions()
+	funcs := a.urlForFuncs()
+	for name, fn := range o.Funcs {
+		funcs[name] = fn
+	}
+	o.Funcs = funcs
+	return o
+}
@@ -0,0 +1,511 @@
+package webfw
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/OpenDriversLog/goodl-lib/translate"
+	"golang.org/x/net/context"
+)
+
+// FieldError describes an invalid value of a form field.
+type FieldError struct {
+	// Field is the name of the field in the form (or JSON body), e.g. "address.street" or "stops[1].name".
+	Field string `json:"field" xml:"field,attr"`
+	// Rule is the validation rule that failed, "type" if the value could not be converted.
+	Rule string `json:"rule" xml:"rule,attr"`
+	// Message is the untranslated message, formatted with Args.
+	Message string        `json:"-" xml:"-"`
+	Args    []interface{} `json:"-" xml:"-"`
+	// Text is the message translated by the Translater of the request.
+	Text string `json:"message" xml:",chardata"`
+}
+
+func (e *FieldError) Error() string {
+	if e.Text != "" {
+		return e.Field + " : " + e.Text
+	}
+	return e.Field + " : " + fmt.Sprintf(e.Message, e.Args...)
+}
+
+// FieldErrors contains the FieldErrors of a form, shown by templates next to their inputs :
+//
+//	<input name="title" value="{[{.Data.form.Title}]}">
+//	{[{with .FieldErrors.For "title"}]}<span class="error">{[{.}]}</span>{[{end}]}
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// For returns the text of the first error of the field with the given name or "".
+func (e FieldErrors) For(field string) string {
+	for _, err := range e {
+		if err.Field == field {
+			return err.Text
+		}
+	}
+	return ""
+}
+
+// All returns the texts of all errors of the field with the given name.
+func (e FieldErrors) All(field string) (texts []string) {
+	for _, err := range e {
+		if err.Field == field {
+			texts = append(texts, err.Text)
+		}
+	}
+	return
+}
+
+// Has returns whether the field with the given name has an error - or, if no name is given, any field.
+func (e FieldErrors) Has(field ...string) bool {
+	if len(field) == 0 {
+		return len(e) != 0
+	}
+	return hasError(e, field[0])
+}
+
+// translate sets the Text of every FieldError using the given Translater.
+func (e FieldErrors) translate(T *translate.Translater) {
+	for _, err := range e {
+		if T != nil {
+			err.Text = T.T(err.Message, err.Args...)
+		} else {
+			err.Text = fmt.Sprintf(err.Message, err.Args...)
+		}
+	}
+}
+
+// FormValidator is implemented by forms with checks that can not be expressed by the tag validate, e.g. comparing
+// two fields. BindForm & Validate append the returned FieldErrors, the Messages are translated.
+type FormValidator interface {
+	ValidateForm() FieldErrors
+}
+
+// ValidationRule checks the value of a field against the parameter of the rule (e.g. "3" for "min=3").
+// It returns nil for a valid value, otherwise a FieldError with Message & Args - Field & Rule are set by the caller.
+type ValidationRule func(v reflect.Value, param string) *FieldError
+
+// registeredRule is a ValidationRule with the check of its parameter & field type, see ruleCheck.
+type registeredRule struct {
+	rule  ValidationRule
+	check ruleCheck
+}
+
+// ruleCheck returns an error if a rule can not be used with the given parameter for a field of type t.
+// It is called once per struct type, so rules can rely on valid parameters while validating.
+type ruleCheck func(t reflect.Type, param string) error
+
+var validationRules = struct {
+	sync.RWMutex
+	m map[string]registeredRule
+}{m: map[string]registeredRule{
+	"min":     {ruleMin, checkCompareRule},
+	"max":     {ruleMax, checkCompareRule},
+	"len":     {ruleLen, checkCompareRule},
+	"email":   {ruleEmail, checkStringRule},
+	"url":     {ruleURL, checkStringRule},
+	"oneof":   {ruleOneOf, nil},
+	"pattern": {rulePattern, checkPatternRule},
+}}
+
+// RegisterValidationRule adds or replaces the ValidationRule with the given name, usable in the tag validate.
+// Register rules before validating, as the rules of a struct type are parsed once.
+func RegisterValidationRule(name string, rule ValidationRule) {
+	validationRules.Lock()
+	validationRules.m[name] = registeredRule{rule: rule}
+	validationRules.Unlock()
+}
+
+// getValidationRule returns the ValidationRule registered with the given name.
+func getValidationRule(name string) (r registeredRule, ok bool) {
+	validationRules.RLock()
+	r, ok = validationRules.m[name]
+	validationRules.RUnlock()
+	return
+}
+
+// fieldRule is a rule of the tag validate of a field.
+type fieldRule struct {
+	name  string
+	param string
+	// rule is nil for required.
+	rule ValidationRule
+}
+
+// structRules are the parsed rules of a struct type by field index.
+type structRules struct {
+	fields map[int][]fieldRule
+	err    error
+}
+
+// ruleCache caches the structRules by struct type.
+var ruleCache = struct {
+	sync.Mutex
+	m map[reflect.Type]*structRules
+}{m: make(map[reflect.Type]*structRules)}
+
+// rulesFor returns the parsed rules of the fields of the struct type t. The rules of t & of the struct types
+// nested in it are checked at first use - an invalid tag validate is returned as error every time t is used.
+func rulesFor(t reflect.Type) (*structRules, error) {
+	ruleCache.Lock()
+	defer ruleCache.Unlock()
+	rules := parseStructRules(t)
+	return rules, rules.err
+}
+
+// parseStructRules parses the rules of t & its nested struct types into the ruleCache, which must be locked.
+func parseStructRules(t reflect.Type) *structRules {
+	if rules, ok := ruleCache.m[t]; ok {
+		return rules
+	}
+	rules := &structRules{fields: make(map[int][]fieldRule)}
+	// Stored first, so recursive types end here.
+	ruleCache.m[t] = rules
+	for i := 0; i < t.NumField() && rules.err == nil; i++ {
+		f := t.Field(i)
+		if tag := f.Tag.Get("validate"); tag != "" {
+			fr, err := parseRules(f.Type, tag)
+			if err != nil {
+				rules.err = fmt.Errorf("webfw: %v field %s : %v", t, f.Name, err)
+				break
+			}
+			rules.fields[i] = fr
+		}
+		if nested := nestedStructType(f.Type); nested != nil {
+			if err := parseStructRules(nested).err; err != nil {
+				rules.err = err
+			}
+		}
+	}
+	return rules
+}
+
+// nestedStructType returns the struct type validated by validateNested for a field of type t - nil if there is none.
+func nestedStructType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil
+	}
+	return t
+}
+
+// parseRules parses the comma separated rules of a tag validate of a field of type t.
+// The parameter of pattern is the rest of the tag, so it must be the last rule.
+func parseRules(t reflect.Type, tag string) (rules []fieldRule, err error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for rest := tag; rest != ""; {
+		rule := rest
+		if strings.HasPrefix(strings.TrimSpace(rest), "pattern=") {
+			rest = ""
+		} else if i := strings.Index(rest, ","); i >= 0 {
+			rule, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		fr := fieldRule{name: strings.TrimSpace(name), param: param}
+		switch fr.name {
+		case "":
+			return nil, fmt.Errorf("empty rule in %q", tag)
+		case "required":
+		default:
+			r, ok := getValidationRule(fr.name)
+			if !ok {
+				return nil, fmt.Errorf("unknown validation rule %q", fr.name)
+			}
+			if r.check != nil {
+				if err = r.check(t, param); err != nil {
+					return nil, fmt.Errorf("rule %q : %v", rule, err)
+				}
+			}
+			fr.rule = r.rule
+		}
+		rules = append(rules, fr)
+	}
+	return
+}
+
+// Validate checks the struct (or pointer to a struct) v against the rules of the tags validate of its fields and
+// returns the FieldErrors, named by the tags form & translated by the Translater of the context - nil if v is valid.
+// Rules are separated by commas, e.g. `validate:"required,min=3,max=100"` :
+//
+//	required        the value must not be empty (or false)
+//	min=n, max=n    the minimum/maximum number, length of a string (in characters) or number of entries
+//	len=n           the exact length of a string or number of entries
+//	email, url      an e-mail address or http(s) URL
+//	oneof=a b c     one of the values separated by spaces
+//	pattern=^re$    matches the regular expression - as it may contain commas, it must be the last rule
+//
+// Rules other than required accept empty values, more rules can be added using RegisterValidationRule.
+// Nested structs, pointers to structs & slices of structs are validated too.
+// The rules of a struct type are checked once - unknown rules or invalid parameters are returned as error.
+func (a *App) Validate(ctx context.Context, v interface{}) (FieldErrors, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Validate : %T is no struct", v)
+	}
+	errs, err := validateValue(rv, "", "form", nil)
+	if err != nil {
+		return nil, err
+	}
+	if fv, ok := v.(FormValidator); ok {
+		errs = append(errs, fv.ValidateForm()...)
+	}
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	errs.translate(a.requestTranslater(ctx))
+	return errs, nil
+}
+
+// validateValue validates the fields of the struct v named below prefix by the tag tagKey.
+// Fields with an error in failed are skipped.
+func validateValue(v reflect.Value, prefix string, tagKey string, failed FieldErrors) (errs FieldErrors, err error) {
+	t := v.Type()
+	rules, err := rulesFor(t)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		var nested FieldErrors
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get(tagKey) == "" {
+			if nested, err = validateValue(fv, prefix, tagKey, failed); err != nil {
+				return nil, err
+			}
+			errs = append(errs, nested...)
+			continue
+		}
+		name := fieldName(f, tagKey)
+		if name == "" || f.PkgPath != "" {
+			continue
+		}
+		name = joinName(prefix, name)
+		if hasError(failed, name) {
+			continue
+		}
+		if fe := checkRules(fv, rules.fields[i]); fe != nil {
+			fe.Field = name
+			errs = append(errs, fe)
+			continue
+		}
+		if nested, err = validateNested(fv, name, tagKey, failed); err != nil {
+			return nil, err
+		}
+		errs = append(errs, nested...)
+	}
+	return
+}
+
+// hasError returns whether errs contains an error for the field with the given name (the Texts may not be set yet).
+func hasError(errs FieldErrors, name string) bool {
+	for _, err := range errs {
+		if err.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateNested validates the struct, pointer to a struct or slice of structs v named name.
+func validateNested(v reflect.Value, name string, tagKey string, failed FieldErrors) (errs FieldErrors, err error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			errs, err = validateNested(v.Elem(), name, tagKey, failed)
+		}
+	case reflect.Struct:
+		if v.Type() != timeType {
+			errs, err = validateValue(v, name, tagKey, failed)
+		}
+	case reflect.Slice, reflect.Array:
+		if k := v.Type().Elem().Kind(); k == reflect.Struct || k == reflect.Ptr {
+			for i := 0; i < v.Len() && err == nil; i++ {
+				var nested FieldErrors
+				nested, err = validateNested(v.Index(i), name+"["+strconv.Itoa(i)+"]", tagKey, failed)
+				errs = append(errs, nested...)
+			}
+		}
+	}
+	return
+}
+
+// checkRules checks v against the parsed rules & returns the FieldError of the first failing one.
+func checkRules(v reflect.Value, rules []fieldRule) *FieldError {
+	for _, r := range rules {
+		if r.rule == nil {
+			if isEmptyValue(v) {
+				return &FieldError{Rule: r.name, Message: "This field is required."}
+			}
+			continue
+		}
+		if isEmptyValue(v) {
+			continue
+		}
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if err := r.rule(v, r.param); err != nil {
+			err.Rule = r.name
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCompareRule is the ruleCheck of min, max & len.
+func checkCompareRule(t reflect.Type, param string) error {
+	if _, err := strconv.ParseFloat(param, 64); err != nil {
+		return fmt.Errorf("%q is no number", param)
+	}
+	switch k := t.Kind(); {
+	case k == reflect.String, k == reflect.Slice, k == reflect.Map, k == reflect.Array,
+		k >= reflect.Int && k <= reflect.Float64:
+		return nil
+	}
+	return fmt.Errorf("can not compare %v", t)
+}
+
+// checkStringRule is the ruleCheck of rules for strings.
+func checkStringRule(t reflect.Type, param string) error {
+	if t.Kind() != reflect.String {
+		return fmt.Errorf("%v is no string", t)
+	}
+	return nil
+}
+
+// checkPatternRule is the ruleCheck of pattern, compiling the regular expression into the cache of rulePattern.
+func checkPatternRule(t reflect.Type, param string) error {
+	if err := checkStringRule(t, param); err != nil {
+		return err
+	}
+	re, err := regexp.Compile(param)
+	if err != nil {
+		return err
+	}
+	patterns.Store(param, re)
+	return nil
+}
+
+// isEmptyValue returns whether v is the zero value, an empty or blank string or an empty slice.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// ruleMin is the ValidationRule min.
+func ruleMin(v reflect.Value, param string) *FieldError {
+	return compareRule(v, param, func(n float64, p float64) bool { return n >= p },
+		"Please enter at least %v characters.", "Please enter a value of at least %v.", "Please choose at least %v entries.")
+}
+
+// ruleMax is the ValidationRule max.
+func ruleMax(v reflect.Value, param string) *FieldError {
+	return compareRule(v, param, func(n float64, p float64) bool { return n <= p },
+		"Please enter at most %v characters.", "Please enter a value of at most %v.", "Please choose at most %v entries.")
+}
+
+// ruleLen is the ValidationRule len.
+func ruleLen(v reflect.Value, param string) *FieldError {
+	return compareRule(v, param, func(n float64, p float64) bool { return n == p },
+		"Please enter exactly %v characters.", "Please enter exactly %v.", "Please choose exactly %v entries.")
+}
+
+// compareRule compares the length of strings, slices & maps or the value of numbers with param using ok.
+// The message depends on the kind of v.
+// The parameter & the kind of v were checked by checkCompareRule.
+func compareRule(v reflect.Value, param string, ok func(n float64, p float64) bool, strMsg string, numMsg string, lenMsg string) *FieldError {
+	p, _ := strconv.ParseFloat(param, 64)
+	var n float64
+	msg := numMsg
+	switch k := v.Kind(); {
+	case k == reflect.String:
+		n, msg = float64(utf8.RuneCountInString(v.String())), strMsg
+	case k == reflect.Slice || k == reflect.Map || k == reflect.Array:
+		n, msg = float64(v.Len()), lenMsg
+	case k >= reflect.Int && k <= reflect.Int64:
+		n = float64(v.Int())
+	case k >= reflect.Uint && k <= reflect.Uint64:
+		n = float64(v.Uint())
+	case k == reflect.Float32 || k == reflect.Float64:
+		n = v.Float()
+	}
+	if ok(n, p) {
+		return nil
+	}
+	return &FieldError{Message: msg, Args: []interface{}{param}}
+}
+
+// ruleEmail is the ValidationRule email.
+func ruleEmail(v reflect.Value, param string) *FieldError {
+	s := strings.TrimSpace(v.String())
+	if a, err := mail.ParseAddress(s); err == nil && a.Address == s {
+		return nil
+	}
+	return &FieldError{Message: "Please enter a valid e-mail address."}
+}
+
+// ruleURL is the ValidationRule url.
+func ruleURL(v reflect.Value, param string) *FieldError {
+	if u, err := url.ParseRequestURI(strings.TrimSpace(v.String())); err == nil &&
+		(u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return nil
+	}
+	return &FieldError{Message: "Please enter a valid URL."}
+}
+
+// ruleOneOf is the ValidationRule oneof.
+func ruleOneOf(v reflect.Value, param string) *FieldError {
+	s := fmt.Sprint(v.Interface())
+	for _, option := range strings.Fields(param) {
+		if s == option {
+			return nil
+		}
+	}
+	return &FieldError{Message: "Please choose one of %v.", Args: []interface{}{strings.Join(strings.Fields(param), ", ")}}
+}
+
+// patterns caches the regular expressions of the ValidationRule pattern.
+var patterns sync.Map
+
+// rulePattern is the ValidationRule pattern, using the regular expression compiled by checkPatternRule.
+func rulePattern(v reflect.Value, param string) *FieldError {
+	if re, ok := patterns.Load(param); ok && re.(*regexp.Regexp).MatchString(v.String()) {
+		return nil
+	}
+	return &FieldError{Message: "Please enter a value in the requested format."}
+}
@@ -0,0 +1,148 @@
+package webfw
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+type validateTestForm struct {
+	Name    string            `form:"name" validate:"required,min=2,max=5"`
+	Code    string            `form:"code" validate:"len=3"`
+	Age     int               `form:"age" validate:"min=18,max=120"`
+	Score   float64           `form:"score" validate:"max=1.5"`
+	Email   string            `form:"email" validate:"email"`
+	Site    string            `form:"site" validate:"url"`
+	Color   string            `form:"color" validate:"oneof=red green"`
+	Level   int               `form:"level" validate:"oneof=1 2"`
+	Zip     string            `form:"zip" validate:"pattern=^[0-9]{4,5}$"`
+	Tags    []string          `form:"tags" validate:"max=2"`
+	Agree   bool              `form:"agree" validate:"required"`
+	Ref     *string           `form:"ref" validate:"required,min=2"`
+	Stops   []*validateStop   `form:"stops"`
+	Extra   map[string]string `form:"extra" validate:"max=1"`
+	private string            `validate:"required"`
+}
+
+type validateStop struct {
+	Name string `form:"name" validate:"required"`
+}
+
+func TestValidateRules(t *testing.T) {
+	ref := func(s string) *string { return &s }
+	valid := func() validateTestForm {
+		return validateTestForm{Name: "Bob", Agree: true, Ref: ref("ab")}
+	}
+	tests := []struct {
+		name   string
+		modify func(f *validateTestForm)
+		want   []string
+	}{
+		{"empty values pass rules other than required", func(f *validateTestForm) {}, nil},
+		{"all set & valid", func(f *validateTestForm) {
+			f.Code, f.Age, f.Score, f.Email, f.Site = "abc", 18, 1.5, "bob@example.com", "https://example.com/x"
+			f.Color, f.Level, f.Zip, f.Tags, f.Extra = "green", 2, "01234", []string{"a", "b"}, map[string]string{"a": "b"}
+		}, nil},
+		{"required", func(f *validateTestForm) { f.Name, f.Agree, f.Ref = " ", false, nil }, []string{"name:required", "agree:required", "ref:required"}},
+		{"min & max of strings count characters", func(f *validateTestForm) { f.Name = "ä" }, []string{"name:min"}},
+		{"max of strings", func(f *validateTestForm) { f.Name = "äöüäöü" }, []string{"name:max"}},
+		{"len", func(f *validateTestForm) { f.Code = "ab" }, []string{"code:len"}},
+		{"min of numbers", func(f *validateTestForm) { f.Age = 17 }, []string{"age:min"}},
+		{"max of numbers", func(f *validateTestForm) { f.Age, f.Score = 121, 1.6 }, []string{"age:max", "score:max"}},
+		{"email", func(f *validateTestForm) { f.Email = "Bob <bob@example.com>" }, []string{"email:email"}},
+		{"url", func(f *validateTestForm) { f.Site = "ftp://example.com" }, []string{"site:url"}},
+		{"oneof", func(f *validateTestForm) { f.Color, f.Level = "blue", 3 }, []string{"color:oneof", "level:oneof"}},
+		{"pattern with comma", func(f *validateTestForm) { f.Zip = "123" }, []string{"zip:pattern"}},
+		{"max of slices & maps", func(f *validateTestForm) {
+			f.Tags, f.Extra = []string{"a", "b", "c"}, map[string]string{"a": "", "b": ""}
+		}, []string{"tags:max", "extra:max"}},
+		{"rules of pointers check the value", func(f *validateTestForm) { f.Ref = ref("a") }, []string{"ref:min"}},
+		{"nested slice of pointers", func(f *validateTestForm) {
+			f.Stops = []*validateStop{{Name: "A"}, nil, {}}
+		}, []string{"stops[2].name:required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid()
+			tt.modify(&f)
+			errs, err := NewApp(&ServerConfig{}).Validate(context.Background(), &f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fieldErrorNames(errs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+			for _, e := range errs {
+				if e.Text == "" || strings.Contains(e.Text, "%!") {
+					t.Errorf("%s : Text %q not formatted", e.Field, e.Text)
+				}
+			}
+		})
+	}
+}
+
+type validateTestFormValidator struct {
+	From int `form:"from"`
+	To   int `form:"to"`
+}
+
+func (f validateTestFormValidator) ValidateForm() FieldErrors {
+	if f.To < f.From {
+		return FieldErrors{{Field: "to", Rule: "range", Message: "Must not be before %v.", Args: []interface{}{f.From}}}
+	}
+	return nil
+}
+
+func TestValidateFormValidator(t *testing.T) {
+	errs, err := NewApp(&ServerConfig{}).Validate(context.Background(), validateTestFormValidator{From: 2, To: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fieldErrorNames(errs); !reflect.DeepEqual(got, []string{"to:range"}) || errs.For("to") == "" {
+		t.Errorf("errors = %v, want a translated error for to", errs)
+	}
+	if !errs.Has() || !errs.Has("to") || errs.Has("from") {
+		t.Errorf("Has of %v", errs)
+	}
+}
+
+func TestValidateInvalidTags(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"unknown rule", struct {
+			A string `validate:"required,unknown"`
+		}{}},
+		{"empty rule", struct {
+			A string `validate:"required,,min=1"`
+		}{}},
+		{"no number", struct {
+			A string `validate:"min=x"`
+		}{}},
+		{"not comparable", struct {
+			A bool `validate:"max=1"`
+		}{}},
+		{"email of int", struct {
+			A int `validate:"email"`
+		}{}},
+		{"invalid pattern", struct {
+			A string `validate:"pattern=(["`
+		}{}},
+		{"nested", struct {
+			B []struct {
+				A string `validate:"min=x"`
+			}
+		}{}},
+		{"no struct", "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs, err := NewApp(&ServerConfig{}).Validate(context.Background(), tt.v); err == nil {
+				t.Errorf("Validate returned no error, FieldErrors %v", errs)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package webfw
 import (
 	"errors"
 	"html/template"
-	"io/ioutil"
+	"io/fs"
+	"strings"
 	"net/http"
 
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/Compufreak345/dbg"
 	"github.com/OpenDriversLog/goodl-lib/translate"
@@ -18,10 +20,32 @@ const vTag = dbg.Tag("webfw/viewengine.go")
 
 // ViewEngine is used to display views by applying templates.
 type ViewEngine struct {
-	templateCache   map[string]*template.Template
-	SharedTemplates map[string]*template.Template
+	templateCache   map[string]Template
+	SharedTemplates map[string]Template
 	tempCacheMutex *sync.Mutex
 	sharedMutex *sync.Mutex
+	cacheTemplates bool
+	// sharedErrors contains the shared templates that could not be parsed.
+	sharedErrors TemplateErrors
+	// fsys is used to read views & shared templates if set, otherwise they are read from disk.
+	fsys      fs.FS
+	opts      ViewOptions
+	rootDir   string
+	sharedDir string
+	// deps contains the cache keys by the names (see fsName) of the files they were parsed from - guarded by tempCacheMutex.
+	deps map[string]map[string]bool
+	// cacheGen is incremented whenever cache entries are evicted - guarded by tempCacheMutex.
+	cacheGen uint64
+	// sharedErrByName contains the errors of the shared templates that could not be parsed by name - guarded by sharedMutex.
+	sharedErrByName map[string]*TemplateError
+	// watchTemplates starts a templateWatcher on the first GetViewTemplate, see Profile.WatchTemplates.
+	watchTemplates bool
+	watchOnce      sync.Once
+	watcher        *templateWatcher
+	// assets fingerprints the files below the StaticDirs, see Assets.
+	assets *AssetManifest
+	// metrics are the metrics of the App the ViewEngine belongs to.
+	metrics *appMetrics
 }
 
 // ViewData determines which view will be shown and what context it uses.
@@ -33,128 +57,395 @@ type ViewData struct {
 	ErrorType      int
 	ErrorSource    string
 	ErrorMessage   interface{}
+	// ErrorDetail contains source & error if the Profile shows full error details.
+	ErrorDetail    string
 	WarningMessage interface{}
 	StatusMessage  interface{}
+	// FieldErrors are the invalid fields of a form, see BindForm.
+	FieldErrors    FieldErrors
 	Debug          bool
 	ViewName       string
 	Redirect       string
 	NoStyleOnError bool
+	// Status is the status code sent after a successful render - 200 if 0.
+	// For a Redirect, a 3xx Status (e.g. 303 after a form was posted) replaces the default 307.
+	Status int
+	// Stream sends the rendered output whenever the template calls {[{$.Flush}]} (e.g. every 100 rows of a
+	// long list) instead of buffering the complete page. The status & headers are sent with the first Flush,
+	// so an error after it can not be shown anymore.
+	Stream  bool
+	flusher *renderFlusher
+	// typed is the ViewDataOf templates are executed with, see ViewDataOf.Untyped.
+	typed typedViewData
 	//Body    interface{} // if in layout template, this will set
 }
 
 // NewViewEngine returns a new ViewEngine.
+// Shared templates that can not be parsed are logged and skipped - use Preflight to find them before serving requests.
+// Close it when it is not used anymore.
 func NewViewEngine() *ViewEngine {
-	sharedDir := Config().RootDir + "/views/shared/"
-	e := &ViewEngine{templateCache: make(map[string]*template.Template),
-		SharedTemplates: make(map[string]*template.Template),
+	e, _ := defaultApp.newViewEngine(Config())
+	return e
+}
+
+// newViewEngine returns a new ViewEngine for the given ServerConfig, reading from the fs.FS of the App.
+// If the App was precompiled, the views are precompiled too & the views that could not be parsed are returned.
+func (a *App) newViewEngine(c *ServerConfig) (e *ViewEngine, errs []error) {
+	e, errs = newViewEngineFor(c, a.customFS(), a.engineViewOptions(), a.metrics)
+	if !a.isPrecompiled() {
+		return
+	}
+	if err := e.precompile(c, a.Binders()); err != nil {
+		// The errors of the shared templates come first & are already in errs.
+		// Warnings are logged by precompile & do not reject the ViewEngine.
+		for _, te := range err.(TemplateErrors)[len(e.sharedErrors):] {
+			if !te.Warning {
+				errs = append(errs, te)
+			}
+		}
+	}
+	return
+}
+
+// newViewEngineFor returns a new ViewEngine for the given ServerConfig reading from fsys (from disk if nil)
+// using the given ViewOptions & metrics and an error for every shared template that could not be parsed.
+func newViewEngineFor(c *ServerConfig, fsys fs.FS, opts ViewOptions, m *appMetrics) (e *ViewEngine, errs []error) {
+	p := c.Profile()
+	var assets *AssetManifest
+	if p.CacheFiles && len(c.StaticDirs) != 0 {
+		assets = newAssetManifest(siteFS(c, fsys), c.StaticDirs)
+	}
+	e = &ViewEngine{templateCache: make(map[string]Template),
 		tempCacheMutex:&sync.Mutex{},
 		sharedMutex:&sync.Mutex{},
+		cacheTemplates:p.CacheTemplates || p.WatchTemplates,
+		watchTemplates:p.WatchTemplates,
+		fsys: fsys,
+		opts: opts.withViewFuncs(c, assets),
+		assets: assets,
+		rootDir: c.RootDir,
+		sharedDir: sharedTemplateDir(c),
+		deps: make(map[string]map[string]bool),
+		metrics: m,
+	}
+	e.SharedTemplates, e.sharedErrors = e.loadSharedTemplates(e.sharedDir)
+	e.sharedErrByName = e.sharedErrorsByName(e.sharedErrors)
+	for _, err := range e.sharedErrors {
+		dbg.E(vTag, "Error parsing shared template : %v", err)
+		errs = append(errs, err)
+	}
+
+	return
+}
+
+// sharedTemplateDir returns the directory containing the shared templates - SharedDir if set, otherwise RootDir/views/shared/.
+func sharedTemplateDir(c *ServerConfig) string {
+	if c.SharedDir != "" {
+		return c.SharedDir + "/"
 	}
-	files, _ := ioutil.ReadDir(sharedDir)
-	e.sharedMutex.Lock()
+	return c.RootDir + "/views/shared/"
+}
+
+// loadSharedTemplates parses every file in the given directory (and its subdirectories) as shared template,
+// named by its path relative to sharedDir, e.g. "odl.html" or "partials/nav.html".
+// It returns all templates that could be parsed and an error for every other file.
+func (v *ViewEngine) loadSharedTemplates(sharedDir string) (shared map[string]Template, errs TemplateErrors) {
+	shared = make(map[string]Template)
+	v.loadSharedTemplatesIn(sharedDir, "", shared, &errs)
+	return
+}
+
+// loadSharedTemplatesIn parses the shared templates in the subdirectory prefix of sharedDir.
+func (v *ViewEngine) loadSharedTemplatesIn(sharedDir string, prefix string, shared map[string]Template, errs *TemplateErrors) {
+	files, _ := v.readDir(sharedDir + prefix)
 	for _, file := range files {
-		e.SharedTemplates[file.Name()] = template.Must(template.New(file.Name()).Delims("{[{", "}]}").ParseGlob(sharedDir + file.Name()))
+		name := prefix + file.Name()
+		if strings.HasSuffix(name, ViewSidecarSuffix) {
+			continue
+		}
+		if file.IsDir() {
+			v.loadSharedTemplatesIn(sharedDir, name+"/", shared, errs)
+			continue
+		}
+		t, te := v.parseShared(sharedDir, name)
+		if te != nil {
+			*errs = append(*errs, te)
+			continue
+		}
+		shared[name] = t
+	}
+}
+
+// sharedErrorsByName returns the given errors of loadSharedTemplates by the name of their shared template.
+func (v *ViewEngine) sharedErrorsByName(errs TemplateErrors) map[string]*TemplateError {
+	byName := make(map[string]*TemplateError)
+	for _, te := range errs {
+		byName[strings.TrimSuffix(strings.TrimPrefix(te.File, v.sharedDir), ViewSidecarSuffix)] = te
 	}
-	e.sharedMutex.Unlock()
+	return byName
+}
 
-	return e
+// parseShared reads & parses the shared template with the given name from sharedDir using its TemplateEngine.
+func (v *ViewEngine) parseShared(sharedDir string, name string) (Template, *TemplateError) {
+	path := sharedDir + name
+	src, o, err := v.readTemplate(path)
+	if te, ok := err.(*TemplateError); ok {
+		return nil, te
+	} else if err != nil {
+		return nil, &TemplateError{File: path, Message: err.Error(), Err: err}
+	}
+	t, err := templateEngineFor(name).ParseShared(name, src, o)
+	if err != nil {
+		return nil, newTemplateError(path, src, err)
+	}
+	return t, nil
 }
 
-// GetTemplate gets the template with the given key.
-func (v *ViewEngine) GetTemplate(key string, path string, sharedTemplateToUse string) (t *template.Template, err error) {
+// GetTemplate gets the html/template view with the given key.
+//
+// Deprecated: use GetViewTemplate, which also returns views parsed by other TemplateEngines.
+func (v *ViewEngine) GetTemplate(key string, path string, sharedTemplateToUse string) (*template.Template, error) {
+	t, err := v.GetViewTemplate(key, path, sharedTemplateToUse)
+	if err != nil {
+		return nil, err
+	}
+	ht, ok := t.(*template.Template)
+	if !ok {
+		return nil, fmt.Errorf("%s is not parsed by html/template - use GetViewTemplate", path)
+	}
+	return ht, nil
+}
+
+// GetViewTemplate gets the template with the given key, parsed by the TemplateEngine for the extension of path.
+func (v *ViewEngine) GetViewTemplate(key string, path string, sharedTemplateToUse string) (t Template, err error) {
 
-	dbg.D(vTag, "Start GetTemplate for %s,%s,%s", key, path, sharedTemplateToUse)
-	key = key + "-_-" + sharedTemplateToUse
+	dbg.D(vTag, "Start GetViewTemplate for %s,%s,%s", key, path, sharedTemplateToUse)
+	if v.watchTemplates {
+		v.watchOnce.Do(v.watch)
+	}
+	sharedTemplateToUse = normalizeLayout(sharedTemplateToUse)
+	key = templateCacheKey(key, sharedTemplateToUse)
 	v.tempCacheMutex.Lock()
 	mt, ok := v.templateCache[key]
 	v.tempCacheMutex.Unlock()
-	if !dbg.Develop && ok {
+	if v.cacheTemplates && ok {
 		t = mt
-		dbg.D(vTag, "End GetTemplate (template cached)")
+		v.metrics.templateCacheHits.inc()
+		dbg.D(vTag, "End GetViewTemplate (template cached)")
 		return
 	}
+	v.metrics.templateCacheMisses.inc()
 
-	tmplTxt, err := ioutil.ReadFile(path)
+	v.tempCacheMutex.Lock()
+	gen := v.cacheGen
+	v.tempCacheMutex.Unlock()
+	t, err = v.parseView(key, path, sharedTemplateToUse)
 	if err != nil {
-		dbg.W(vTag, "End GetTemplate with error %v", err)
+		v.metrics.templateParseErrors.inc()
+		dbg.W(vTag, "End GetViewTemplate with error %v", err)
 		return
 	}
-	// TODO : Maybe allow multiple templates
-	var x *template.Template
-	if sharedTemplateToUse != "" {
-		v.sharedMutex.Lock()
-		x, _ = v.SharedTemplates[sharedTemplateToUse].Clone()
-		v.sharedMutex.Unlock()
-	} else {
-		x = template.New(key)
-	}
-	x.Delims("{[{", "}]}")
-	t = template.Must(x.Parse(string(tmplTxt)))
 
 	v.tempCacheMutex.Lock()
-	v.templateCache[key] = t
+	// Don't cache what may have been parsed from files that changed meanwhile.
+	if gen == v.cacheGen {
+		v.templateCache[key] = t
+		v.addDeps(key, path, sharedTemplateToUse)
+	}
 	v.tempCacheMutex.Unlock()
-	dbg.D(vTag, "End GetTemplate ")
+	dbg.D(vTag, "End GetViewTemplate ")
 	return
 
 }
 
-// ClearCache clears the cached files, initializing a new ViewEngine
-func (v *ViewEngine) ClearCache() {
-	v = NewViewEngine()
+// Layout returns the value to use as shared template (e.g. the vSharedTemplate returned by a Controller) for a view
+// rendered with the base layout and the given partial sets, all being shared templates.
+// The partials are added to the base layout in the given order, then the view is added - so partials & view
+// may override the blocks ({[{block "name" .}]}) defined before by defining a template with the same name.
+func Layout(base string, partials ...string) string {
+	return strings.Join(append([]string{base}, partials...), ",")
 }
 
-// RenderHttpResp renders the given view.
+// splitLayout returns the names of the shared templates in the given Layout.
+func splitLayout(layout string) (names []string) {
+	for _, name := range strings.Split(layout, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// normalizeLayout removes blanks & empty names from the given Layout, so equal combinations share a cache key.
+func normalizeLayout(layout string) string {
+	return strings.Join(splitLayout(layout), ",")
+}
+
+// templateCacheKey returns the key of the templateCache for the given view key & shared template.
+func templateCacheKey(key string, sharedTemplateToUse string) string {
+	return key + "-_-" + sharedTemplateToUse
+}
+
+// parseView reads the view at the given path and parses it into the given shared templates (see Layout)
+// using the TemplateEngine for its extension. Parse errors are returned as *TemplateError.
+func (v *ViewEngine) parseView(key string, path string, sharedTemplateToUse string) (t Template, err error) {
+	tmplTxt, o, err := v.readTemplate(path)
+	if err != nil {
+		return
+	}
+	layout, err := v.sharedLayout(splitLayout(sharedTemplateToUse))
+	if err != nil {
+		return
+	}
+	if t, err = templateEngineFor(path).ParseView(key, tmplTxt, layout, o); err != nil {
+		return nil, newTemplateError(path, tmplTxt, err)
+	}
+	return
+}
+
+// sharedLayout returns the shared templates with the given names.
+func (v *ViewEngine) sharedLayout(names []string) (layout []Template, err error) {
+	v.sharedMutex.Lock()
+	defer v.sharedMutex.Unlock()
+	for _, name := range names {
+		t, ok := v.SharedTemplates[name]
+		if !ok {
+			return nil, v.unknownSharedError(name)
+		}
+		layout = append(layout, t)
+	}
+	return
+}
+
+// unknownSharedError returns the error for a shared template that is not loaded - v.sharedMutex must be locked.
+func (v *ViewEngine) unknownSharedError(name string) error {
+	if te, ok := v.sharedErrByName[name]; ok {
+		return te
+	}
+	return errors.New("Unknown shared template " + name)
+}
+
+// addDeps records that the cache entry key was parsed from the view at path and the shared templates of the given
+// Layout - v.tempCacheMutex must be locked.
+func (v *ViewEngine) addDeps(key string, path string, layout string) {
+	files := []string{fsName(v.rootDir, path)}
+	for _, name := range splitLayout(layout) {
+		files = append(files, fsName(v.rootDir, v.sharedDir+name))
+	}
+	for _, f := range files {
+		if v.deps[f] == nil {
+			v.deps[f] = make(map[string]bool)
+		}
+		v.deps[f][key] = true
+	}
+}
+
+// redirectStatus returns the status code used to send the Redirect of the ViewData.
+func (vd ViewData) redirectStatus() int {
+	if vd.Status >= 300 && vd.Status < 400 {
+		return vd.Status
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// RenderHttpResp renders the given html/template view, see RenderViewHttpResp.
+//
+// Deprecated: use RenderViewHttpResp, which also renders views parsed by other TemplateEngines.
 func (v *ViewEngine) RenderHttpResp(vd ViewData, t *template.Template, w http.ResponseWriter, r *http.Request, name string) (err error) {
+	return v.RenderViewHttpResp(vd, t, w, r, name)
+}
+
+// RenderViewHttpResp renders the given view into a buffer and sends it with vd.Status once the template executed
+// successfully, so errors are shown instead of a partial page. If vd.Redirect is set, only the redirect is sent.
+// See ViewData.Stream for rendering large pages.
+func (v *ViewEngine) RenderViewHttpResp(vd ViewData, t Template, w http.ResponseWriter, r *http.Request, name string) (err error) {
+	return v.renderHttpResp(vd, t, w, r, name, DirectShowError)
+}
+
+// renderHttpResp is RenderViewHttpResp showing errors using showError.
+func (v *ViewEngine) renderHttpResp(vd ViewData, t Template, w http.ResponseWriter, r *http.Request, name string,
+	showError func(ViewData, error, http.ResponseWriter)) (err error) {
 	vd.Debug = bool(dbg.Debugging)
 	dbg.D(vTag, "Start Render ")
 
-	defer func() {
-		if r := recover(); r != nil {
-			dbg.W(vTag, "Error rendering template ", r)
-			http.Error(w, http.StatusText(500), 500)
-			err = errors.New("Unknown error rendering template")
-			return
-		}
-	}()
 	if vd.Redirect != "" {
-		http.Redirect(w, r, vd.Redirect, 307)
+		http.Redirect(w, r, vd.Redirect, vd.redirectStatus())
+		dbg.D(vTag, "End Render (redirect)")
+		return
+	}
+	status := vd.Status
+	if status == 0 {
+		status = http.StatusOK
 	}
-	err = v.RenderWriter(vd, t, w, name)
+	b := getBuffer()
+	defer putBuffer(b)
+	if vd.Stream {
+		vd.flusher = &renderFlusher{w: w, buf: b, status: status}
+	}
+
+	start := time.Now()
+	err = v.RenderViewWriter(vd, t, b, name)
+	v.metrics.renderDuration.observe(time.Since(start), vd.ViewName)
 	if err != nil {
-		dbg.W(vTag, "Error rendering template : ", err)
-		DirectShowError(vd, err, w)
+		if vd.flusher != nil && vd.flusher.committed {
+			dbg.E(vTag, "Error rendering streamed template after sending the status : %v", err)
+			return
+		}
+		dbg.W(vTag, "Error rendering template : %v", err)
+		vd.flusher = nil
+		showError(vd, err, w)
 		return
 	}
+	if vd.flusher != nil {
+		err = vd.flusher.Flush()
+	} else {
+		err = writeBuffered(w, status, b)
+	}
 	dbg.D(vTag, "End Render ")
 	return
 }
 
-// RenderWriter writes the given view to the output writer.
+// Flush sends the output rendered so far to the client if the ViewData is streamed, see ViewData.Stream.
+// Use it in templates as {[{$.Flush}]}.
+func (vd ViewData) Flush() (string, error) {
+	if vd.flusher == nil {
+		return "", nil
+	}
+	return "", vd.flusher.Flush()
+}
+
+// RenderWriter writes the given html/template view to the output writer.
+//
+// Deprecated: use RenderViewWriter, which also renders views parsed by other TemplateEngines.
 func (v *ViewEngine) RenderWriter(vd ViewData, t *template.Template, w io.Writer, name string) (err error) {
+	return v.RenderViewWriter(vd, t, w, name)
+}
+
+// RenderViewWriter writes the given view to the output writer.
+func (v *ViewEngine) RenderViewWriter(vd ViewData, t Template, w io.Writer, name string) (err error) {
 	vd.Debug = bool(dbg.Debugging)
-	dbg.D(vTag, "Start RenderWriter ")
+	dbg.D(vTag, "Start RenderViewWriter ")
 
 	defer func() {
 		if r := recover(); r != nil {
 			dbg.W(vTag, "Error rendering template ", r)
-			err = errors.New(fmt.Sprintf("", r))
+			err = errors.New(fmt.Sprintf("%v", r))
 			return
 		}
 	}()
 	// t = t.Delims("{[{", "}]}")
 
 	if name == "" {
-		err = t.Execute(w, interface{}(vd))
+		err = t.Execute(w, vd.templateData())
 	} else {
-		err = t.ExecuteTemplate(w, name, interface{}(vd))
+		err = t.ExecuteTemplate(w, name, vd.templateData())
 
 	}
 	if err != nil {
 		dbg.W(vTag, "Error rendering template : ", err)
 		return
 	}
-	dbg.D(vTag, "End RenderWriter ")
+	dbg.D(vTag, "End RenderViewWriter ")
 	return
 }
 
@@ -0,0 +1,221 @@
+package webfw
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/OpenDriversLog/goodl-lib/translate"
+)
+
+// PluralForm returns the index of the plural form to use for the count n in the given language (e.g. "de-DE"),
+// see the template function tn. The default rule fits German & English : 0 for one, 1 for everything else.
+var PluralForm = func(lang string, n int) int {
+	if n == 1 {
+		return 0
+	}
+	return 1
+}
+
+// ViewFuncs returns the template functions available in every view & shared template of a ViewEngine
+// using the given ServerConfig. Functions set in ViewOptions.Funcs with the same name replace them.
+//
+//	t .T "key" args...         translates the key
+//	tn .T n "one" "other"...   translates the form chosen by PluralForm for n, passing n as argument
+//	longTime t                 formats t (time.Time, *time.Time or unix seconds) using TimeConfig.LongTimeFormatString
+//	shortTime t                formats t using TimeConfig.ShortTimeFormatString
+//	fileTime t                 formats t using TimeConfig.FileTimeFormatString
+//	formatTime t "layout"      formats t using the given layout
+//	url "/path"                prefixes the path with SubDir
+//	asset "/static/odl.css"    like url, using the fingerprinted name of the AssetManifest (e.g. "/static/odl.3f9a1c0b.css")
+//	                           or, for files not in it, adding the Version as fingerprint
+//	json v                     encodes v as JSON, e.g. for use in scripts
+//	attr "name" "value"        a single escaped HTML attribute
+//	attrs "name" "value"...    several escaped HTML attributes
+//
+// All times are shown in TimeConfig.TimeLocation.
+// The views of an App can additionally use urlFor & absURLFor, see App.URLFor.
+func ViewFuncs(c *ServerConfig) template.FuncMap {
+	return viewFuncs(c, nil)
+}
+
+// viewFuncs returns the ViewFuncs of the given ServerConfig, asset using the given AssetManifest (may be nil).
+func viewFuncs(c *ServerConfig, assets *AssetManifest) template.FuncMap {
+	tc := c.TimeConfig
+	if tc == nil {
+		tc = GetDefaultTimeConfig()
+	}
+	return template.FuncMap{
+		"t":  translateFunc,
+		"tn": translatePluralFunc,
+		"longTime": func(t interface{}) (string, error) {
+			return formatTime(tc, t, tc.LongTimeFormatString)
+		},
+		"shortTime": func(t interface{}) (string, error) {
+			return formatTime(tc, t, tc.ShortTimeFormatString)
+		},
+		"fileTime": func(t interface{}) (string, error) {
+			return formatTime(tc, t, tc.FileTimeFormatString)
+		},
+		"formatTime": func(t interface{}, layout string) (string, error) {
+			return formatTime(tc, t, layout)
+		},
+		"url": func(p string) string {
+			return subDirURL(c.SubDir, p)
+		},
+		"asset": func(p string) string {
+			return assetURL(c, assets, p)
+		},
+		"json":  jsonFunc,
+		"attr":  attrFunc,
+		"attrs": attrsFunc,
+	}
+}
+
+// withViewFuncs returns a copy of the ViewOptions whose Funcs contain the ViewFuncs of the given ServerConfig
+// & AssetManifest.
+func (o ViewOptions) withViewFuncs(c *ServerConfig, assets *AssetManifest) ViewOptions {
+	funcs := viewFuncs(c, assets)
+	for name, fn := range o.Funcs {
+		funcs[name] = fn
+	}
+	o.Funcs = funcs
+	return o
+}
+
+// translateFunc is the template function t.
+func translateFunc(T *translate.Translater, key string, args ...interface{}) string {
+	if T == nil {
+		return key
+	}
+	return T.T(key, args...)
+}
+
+// translatePluralFunc is the template function tn.
+func translatePluralFunc(T *translate.Translater, n int, forms ...string) (string, error) {
+	if len(forms) == 0 {
+		return "", fmt.Errorf("tn : no plural forms given for %d", n)
+	}
+	lang := ""
+	if T != nil {
+		lang = T.DefaultLang
+	}
+	i := PluralForm(lang, n)
+	if i < 0 {
+		i = 0
+	} else if i >= len(forms) {
+		i = len(forms) - 1
+	}
+	return translateFunc(T, forms[i], n), nil
+}
+
+// formatTime formats the given time.Time, *time.Time or unix timestamp in the TimeLocation of the TimeConfig.
+func formatTime(tc *TimeConfig, t interface{}, layout string) (string, error) {
+	var tm time.Time
+	switch v := t.(type) {
+	case time.Time:
+		tm = v
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		tm = *v
+	case int64:
+		tm = time.Unix(v, 0)
+	case int:
+		tm = time.Unix(int64(v), 0)
+	default:
+		return "", fmt.Errorf("can not format %T as time", t)
+	}
+	if tc != nil && tc.TimeLocation != nil {
+		tm = tm.In(tc.TimeLocation)
+	}
+	return tm.Format(layout), nil
+}
+
+// subDirURL prefixes the given site-relative path with subDir. Absolute URLs are returned unchanged.
+func subDirURL(subDir string, p string) string {
+	if strings.Contains(p, "://") || strings.HasPrefix(p, "//") {
+		return p
+	}
+	return strings.TrimSuffix(subDir, "/") + "/" + strings.TrimPrefix(p, "/")
+}
+
+// assetURL returns the URL of the fingerprinted name of the given asset or, if it is not in the AssetManifest,
+// the URL with the Version of the ServerConfig as fingerprint.
+func assetURL(c *ServerConfig, assets *AssetManifest, p string) string {
+	if name, ok := assets.Fingerprinted(p); ok {
+		return subDirURL(c.SubDir, name)
+	}
+	u := subDirURL(c.SubDir, p)
+	if c.Version == "" {
+		return u
+	}
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	return u + sep + "v=" + c.Version
+}
+
+// jsonFunc is the template function json.
+func jsonFunc(v interface{}) (template.JS, error) {
+	b, err := json.Marshal(v)
+	return template.JS(b), err
+}
+
+// attrNameRegexp matches the HTML attribute names accepted by attr & attrs.
+var attrNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][-a-zA-Z0-9_:.]*$`)
+
+// urlAttrs contains the attributes whose value is a URL.
+var urlAttrs = map[string]bool{"href": true, "src": true, "action": true, "formaction": true, "poster": true, "cite": true}
+
+// attrFunc is the template function attr.
+// Event handler & style attributes are refused, URLs using other schemes than http(s) & mailto are replaced.
+func attrFunc(name string, value interface{}) (template.HTMLAttr, error) {
+	lower := strings.ToLower(name)
+	if !attrNameRegexp.MatchString(name) || strings.HasPrefix(lower, "on") || lower == "style" {
+		return "", fmt.Errorf("attr : unsafe attribute name %q", name)
+	}
+	v := fmt.Sprint(value)
+	if urlAttrs[lower] && !safeURL(v) {
+		v = "#ZgotmplZ"
+	}
+	return template.HTMLAttr(name + `="` + template.HTMLEscapeString(v) + `"`), nil
+}
+
+// attrsFunc is the template function attrs.
+func attrsFunc(pairs ...interface{}) (template.HTMLAttr, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("attrs : odd number of arguments %d", len(pairs))
+	}
+	attrs := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("attrs : attribute name %v is no string", pairs[i])
+		}
+		a, err := attrFunc(name, pairs[i+1])
+		if err != nil {
+			return "", err
+		}
+		attrs = append(attrs, string(a))
+	}
+	return template.HTMLAttr(strings.Join(attrs, " ")), nil
+}
+
+// safeURL returns false for URLs using other schemes than http, https & mailto.
+func safeURL(u string) bool {
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+	switch strings.ToLower(u[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package webfw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The default template action delimiters.
+const (
+	DefaultLeftDelim  = "{[{"
+	DefaultRightDelim = "}]}"
+)
+
+// ViewSidecarSuffix is appended to the file name of a view or shared template to get its sidecar file,
+// e.g. "views/odl.html.opts.yaml". Sidecar files contain the same YAML settings as a front-matter.
+const ViewSidecarSuffix = ".opts.yaml"
+
+// ViewOptions configure how the ViewEngine parses & executes templates.
+//
+// Single views & shared templates may override Delims & Options by a YAML front-matter
+//
+//	---
+//	delims: ["{{", "}}"]
+//	options: ["missingkey=error"]
+//	---
+//	<h1>{{.Data.Title}}</h1>
+//
+// or by a sidecar file containing the same YAML (see ViewSidecarSuffix). The front-matter wins over the sidecar file.
+// A leading "---" block is only taken as front-matter if it is closed by "---" and is YAML setting delims or
+// options - otherwise it stays part of the template. TemplateEngines can disable front-matters, see WithoutFrontMatter.
+type ViewOptions struct {
+	// LeftDelim & RightDelim are the template action delimiters - DefaultLeftDelim & DefaultRightDelim if empty.
+	LeftDelim  string
+	RightDelim string
+	// Options are passed to template.Option, e.g. "missingkey=error".
+	Options []string
+	// Funcs are available in every view & shared template in addition to the ViewFuncs.
+	Funcs template.FuncMap
+}
+
+// viewFrontMatter contains the settings of a front-matter or sidecar file.
+type viewFrontMatter struct {
+	Delims  []string `yaml:"delims"`
+	Options []string `yaml:"options"`
+}
+
+// SetViewOptions sets the ViewOptions used by the ViewEngine of the App. The ViewEngine is rebuilt.
+func (a *App) SetViewOptions(o ViewOptions) error {
+	if err := o.check(); err != nil {
+		return err
+	}
+	a.configMutex.Lock()
+	a.viewOptions = o
+	a.configMutex.Unlock()
+	c := a.Config()
+	v, _ := a.newViewEngine(c)
+	a.swapConfig(c, v)
+	return nil
+}
+
+// ViewOptions returns the ViewOptions set using SetViewOptions.
+func (a *App) ViewOptions() ViewOptions {
+	a.configMutex.RLock()
+	defer a.configMutex.RUnlock()
+	return a.viewOptions
+}
+
+// check returns an error if the ViewOptions are invalid.
+func (o ViewOptions) check() error {
+	if (o.LeftDelim == "") != (o.RightDelim == "") {
+		return errors.New("ViewOptions : LeftDelim & RightDelim must both be set or both be empty")
+	}
+	return checkTemplateOptions(o.Options)
+}
+
+// checkTemplateOptions returns an error if template.Option panics for the given options.
+func checkTemplateOptions(opts []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("ViewOptions : %v", r)
+		}
+	}()
+	template.New("").Option(opts...)
+	return
+}
+
+// delims returns the delimiters to use.
+func (o ViewOptions) delims() (string, string) {
+	if o.LeftDelim == "" {
+		return DefaultLeftDelim, DefaultRightDelim
+	}
+	return o.LeftDelim, o.RightDelim
+}
+
+// apply configures t to be parsed & executed using the ViewOptions.
+func (o ViewOptions) apply(t *template.Template) *template.Template {
+	t.Delims(o.delims())
+	if o.Funcs != nil {
+		t.Funcs(o.Funcs)
+	}
+	if len(o.Options) != 0 {
+		t.Option(o.Options...)
+	}
+	return t
+}
+
+// applyText configures the text/template t like apply.
+func (o ViewOptions) applyText(t *texttemplate.Template) *texttemplate.Template {
+	t.Delims(o.delims())
+	if o.Funcs != nil {
+		t.Funcs(texttemplate.FuncMap(o.Funcs))
+	}
+	if len(o.Options) != 0 {
+		t.Option(o.Options...)
+	}
+	return t
+}
+
+// override returns the ViewOptions with the settings of the given front-matter applied.
+func (o ViewOptions) override(fm viewFrontMatter) (ViewOptions, error) {
+	if fm.Delims != nil {
+		if len(fm.Delims) != 2 || fm.Delims[0] == "" || fm.Delims[1] == "" {
+			return o, errors.New("delims must contain the left & the right delimiter")
+		}
+		o.LeftDelim, o.RightDelim = fm.Delims[0], fm.Delims[1]
+	}
+	if fm.Options != nil {
+		if err := checkTemplateOptions(fm.Options); err != nil {
+			return o, err
+		}
+		o.Options = append(append([]string{}, o.Options...), fm.Options...)
+	}
+	return o, nil
+}
+
+// readTemplate reads the view or shared template at the given path and returns its source without the front-matter
+// and the ViewOptions to parse it with. The front-matter is replaced by empty lines to keep the line numbers.
+func (v *ViewEngine) readTemplate(path string) (src []byte, o ViewOptions, err error) {
+	o = v.opts
+	if src, err = v.readFile(path); err != nil {
+		return
+	}
+
+	sidecar, err := v.readFile(path + ViewSidecarSuffix)
+	if err == nil {
+		if o, err = parseFrontMatter(o, sidecar); err != nil {
+			return nil, o, &TemplateError{File: path + ViewSidecarSuffix, Message: err.Error(), Err: err}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, o, err
+	}
+
+	if !frontMatterAllowed(path) {
+		return src, o, nil
+	}
+	fm, src := splitFrontMatter(src)
+	if fm != nil {
+		if o, err = parseFrontMatter(o, fm); err != nil {
+			return nil, o, &TemplateError{File: path, Message: "front-matter : " + err.Error(), Err: err}
+		}
+	}
+	return src, o, nil
+}
+
+// parseFrontMatter applies the given YAML front-matter to o.
+func parseFrontMatter(o ViewOptions, data []byte) (ViewOptions, error) {
+	var fm viewFrontMatter
+	if err := yaml.UnmarshalStrict(data, &fm); err != nil {
+		return o, err
+	}
+	return o.override(fm)
+}
+
+// splitFrontMatter returns the front-matter between the "---" lines at the start of src (nil if there is none)
+// and src with the front-matter replaced by empty lines.
+func splitFrontMatter(src []byte) (fm []byte, body []byte) {
+	if !bytes.HasPrefix(src, []byte("---\n")) && !bytes.HasPrefix(src, []byte("---\r\n")) {
+		return nil, src
+	}
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(string(lines[i]), "\r\n") == "---" {
+			fm = bytes.Join(lines[1:i], nil)
+			if !isFrontMatter(fm) {
+				return nil, src
+			}
+			body = append(bytes.Repeat([]byte("\n"), i+1), bytes.Join(lines[i+1:], nil)...)
+			return
+		}
+	}
+	return nil, src
+}
+
+// isFrontMatter returns whether the block between the "---" lines is YAML setting delims or options,
+// e.g. not the front-matter of a Markdown file or a horizontal rule in a text.
+func isFrontMatter(block []byte) bool {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(block, &m); err != nil {
+		return false
+	}
+	_, delims := m["delims"]
+	_, options := m["options"]
+	return delims || options
+}
+
+// FrontMatterEngine is implemented by TemplateEngines deciding whether their files may start with a front-matter
+// (see ViewOptions) - engines not implementing it allow one.
+type FrontMatterEngine interface {
+	TemplateEngine
+	FrontMatter() bool
+}
+
+// WithoutFrontMatter returns the TemplateEngine e keeping a leading "---" block of its files as content,
+// e.g. for Markdown :
+//
+//	webfw.RegisterTemplateEngine(".md", webfw.WithoutFrontMatter(webfw.TextTemplateEngine))
+//
+// Sidecar files still apply.
+func WithoutFrontMatter(e TemplateEngine) TemplateEngine {
+	return noFrontMatterEngine{e}
+}
+
+// noFrontMatterEngine is a TemplateEngine returned by WithoutFrontMatter.
+type noFrontMatterEngine struct {
+	TemplateEngine
+}
+
+func (noFrontMatterEngine) FrontMatter() bool {
+	return false
+}
+
+// frontMatterAllowed returns whether the file at the given path may start with a front-matter.
+func frontMatterAllowed(path string) bool {
+	if e, ok := templateEngineFor(path).(FrontMatterEngine); ok {
+		return e.FrontMatter()
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package webfw
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Compufreak345/dbg"
+	"github.com/fsnotify/fsnotify"
+)
+
+const wTag = dbg.Tag("webfw/watch.go")
+
+// TemplateWatchInterval is the interval in which template files are polled for changes when fsnotify can not be used
+// (e.g. when reading from an fs.FS set using SetFS).
+var TemplateWatchInterval = time.Second
+
+// templateWatcher watches the views & shared templates of a ViewEngine until it is stopped.
+type templateWatcher struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Close stops the goroutines of the ViewEngine watching its template files (see Profile.WatchTemplates).
+// An App closes its ViewEngine itself when replacing it - close the ViewEngines returned by NewViewEngine or
+// NewViewEngineFS once they are not used anymore, unless they became the ViewEngine of an App.
+// A closed ViewEngine can still render, but does not notice changed files anymore.
+func (v *ViewEngine) Close() error {
+	v.StopWatching()
+	return nil
+}
+
+// StopWatching stops watching the template files of the ViewEngine, see Close.
+func (v *ViewEngine) StopWatching() {
+	v.watchOnce.Do(func() {})
+	if w := v.watcher; w != nil {
+		w.stopOnce.Do(func() { close(w.stop) })
+	}
+}
+
+// watch starts watching the views & shared templates, evicting changed files from the caches of the ViewEngine.
+// It uses fsnotify for files on disk and falls back to polling.
+func (v *ViewEngine) watch() {
+	w := &templateWatcher{stop: make(chan struct{})}
+	v.watcher = w
+	if v.fsys == nil {
+		err := v.watchNotify(w)
+		if err == nil {
+			dbg.I(wTag, "Watching templates using fsnotify")
+			return
+		}
+		dbg.W(wTag, "Can not watch templates using fsnotify, polling instead : %v", err)
+	}
+	dbg.I(wTag, "Watching templates by polling every %v", TemplateWatchInterval)
+	go v.watchPoll(w)
+}
+
+// watchRoots returns the directories containing views & shared templates.
+func (v *ViewEngine) watchRoots() []string {
+	return []string{v.rootDir + "/views", strings.TrimSuffix(v.sharedDir, "/")}
+}
+
+// watchNotify watches the template directories on disk using fsnotify.
+func (v *ViewEngine) watchNotify(w *templateWatcher) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, root := range v.watchRoots() {
+		if _, err = os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		if err = v.addWatchDirs(fw, root, false); err != nil {
+			fw.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer fw.Close()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case ev, ok := <-fw.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod {
+					continue
+				}
+				if ev.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						if err = v.addWatchDirs(fw, ev.Name, true); err != nil {
+							dbg.W(wTag, "Can not watch %s : %v", ev.Name, err)
+						}
+						continue
+					}
+				}
+				v.fileChanged(fsName(v.rootDir, ev.Name))
+			case err, ok := <-fw.Errors:
+				if !ok {
+					return
+				}
+				dbg.W(wTag, "Error watching templates : %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// addWatchDirs adds dir and all directories below to fw. If isNew is set, the files found are handled as changed.
+func (v *ViewEngine) addWatchDirs(fw *fsnotify.Watcher, dir string, isNew bool) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return fw.Add(p)
+		}
+		if isNew {
+			v.fileChanged(fsName(v.rootDir, p))
+		}
+		return nil
+	})
+}
+
+// fileStamp identifies the version of a polled file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchPoll polls the template directories every TemplateWatchInterval.
+func (v *ViewEngine) watchPoll(w *templateWatcher) {
+	prev := v.pollFiles()
+	t := time.NewTicker(TemplateWatchInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+		}
+		cur := v.pollFiles()
+		for name, stamp := range cur {
+			if old, ok := prev[name]; !ok || old != stamp {
+				v.fileChanged(name)
+			}
+		}
+		for name := range prev {
+			if _, ok := cur[name]; !ok {
+				v.fileChanged(name)
+			}
+		}
+		prev = cur
+	}
+}
+
+// pollFiles returns the fileStamps of all files in the template directories by their names (see fsName).
+func (v *ViewEngine) pollFiles() map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	walk := func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files[fsName(v.rootDir, p)] = fileStamp{info.ModTime(), info.Size()}
+		}
+		return nil
+	}
+	for _, root := range v.watchRoots() {
+		if v.fsys == nil {
+			filepath.WalkDir(root, walk)
+		} else {
+			fs.WalkDir(v.fsys, fsName(v.rootDir, root), walk)
+		}
+	}
+	return files
+}
+
+// fileChanged handles a change of the file with the given name (see fsName), see InvalidateFile.
+func (v *ViewEngine) fileChanged(name string) {
+	evicted := v.InvalidateFile(name)
+	dbg.D(wTag, "Template file changed : %s - evicted %v", name, evicted)
+}
+
+// reloadShared parses the shared template with the given name again. If it was removed or can not be parsed,
+// it is removed from SharedTemplates - views using it fail with its TemplateError until it is fixed.
+func (v *ViewEngine) reloadShared(name string) {
+	t, te := v.parseShared(v.sharedDir, name)
+	v.sharedMutex.Lock()
+	defer v.sharedMutex.Unlock()
+	delete(v.SharedTemplates, name)
+	delete(v.sharedErrByName, name)
+	switch {
+	case te == nil:
+		v.SharedTemplates[name] = t
+	case errors.Is(te.Err, fs.ErrNotExist):
+		dbg.I(wTag, "Shared template %s removed", name)
+	default:
+		dbg.E(wTag, "Error parsing shared template : %v", te)
+		v.sharedErrByName[name] = te
+	}
+}